@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/bot"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+)
+
+func main() {
+	configFlags := config.RegisterFlags(flag.CommandLine, false)
+	gameID := flag.String("room", "main", "game room to join")
+	count := flag.Int("n", 4, "number of bots")
+	strategyName := flag.String("strategy", "mixed", "bot strategy: random, aggressive, turtle or mixed")
+	transportName := flag.String("transport", "amqp", "transport: amqp or memory")
+	interval := flag.Duration("interval", 2*time.Second, "time between a bot's turns")
+	duration := flag.Duration("duration", 0, "stop after this long, 0 runs until interrupted")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for the bots' decisions")
+	password := flag.String("password", "peril-bot", "password the bots log in or register with")
+	quiet := flag.Bool("quiet", false, "hide the game output of every bot")
+	keysDir := flag.String("keys-dir", ".", "directory keeping the bots' signing keys")
+	flag.Parse()
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		log.Fatalf("couldn't load config: %v", err)
+	}
+
+	newTransport, err := transportFactory(*transportName, cfg, *password, *keysDir)
+	if err != nil {
+		log.Fatalf("couldn't create %s transport: %v", *transportName, err)
+	}
+
+	if *quiet {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err == nil {
+			os.Stdout = devNull
+		}
+	}
+
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < *count; i++ {
+		name := *strategyName
+		if name == "mixed" {
+			names := bot.GetStrategyNames()
+			name = names[i%len(names)]
+		}
+
+		strategy, err := bot.GetStrategy(name)
+		if err != nil {
+			log.Fatalf("couldn't create bot: %v", err)
+		}
+
+		username := fmt.Sprintf("bot-%s-%d", strategy.Name(), i)
+		transport, err := newTransport(username)
+		if err != nil {
+			log.Fatalf("couldn't connect %s: %v", username, err)
+		}
+
+		b := bot.New(username, *gameID, strategy, transport, *seed+int64(i))
+		err = b.Start()
+		if err != nil {
+			log.Fatalf("couldn't start %s: %v", username, err)
+		}
+
+		log.Printf("Started %s", username)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Run(*interval, done)
+		}()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	if *duration > 0 {
+		select {
+		case <-sigChan:
+		case <-time.After(*duration):
+		}
+	} else {
+		<-sigChan
+	}
+	// the bots say they're leaving before they stop
+	close(done)
+	wg.Wait()
+
+	log.Println("Peril bots stopped.")
+}
+
+// transportFactory returns a function creating each bot's transport. On the
+// broker every bot logs in with its own session, in memory they all share
+// one transport.
+func transportFactory(name string, cfg config.Config, password, keysDir string) (func(username string) (bot.Transport, error), error) {
+	switch name {
+	case "memory":
+		transport := bot.NewMemoryTransport()
+		return func(string) (bot.Transport, error) { return transport, nil }, nil
+	case "amqp":
+		log.Println("Connecting to rabbitMq server...")
+		conn, err := cfg.Broker.Dial()
+		if err != nil {
+			return nil, fmt.Errorf("couldnt dial connection with %s: %v", cfg.Broker.URL, err)
+		}
+
+		keys, err := auth.NewRemoteKeyRegistry(conn, cfg.Keys.Server)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't subscribe to key changes: %v", err)
+		}
+		return func(username string) (bot.Transport, error) {
+			session, err := auth.LoginOrRegister(conn, username, password)
+			if err != nil {
+				return nil, err
+			}
+			signer, err := auth.RegisterSigningKey(conn, session, auth.SigningKeyPath(keysDir, username))
+			if err != nil {
+				return nil, err
+			}
+			return bot.NewAMQPTransport(conn, signer, session.Inbox, keys)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown transport: %s", name)
+}
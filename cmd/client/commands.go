@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errQuit = errors.New("quit")
+
+// client is a logged in player in a room, what the commands act on.
+type client struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	gs       *gamelogic.GameState
+	gameID   string
+	signer   pubsub.Signer
+	inbox    string
+	commands *gamelogic.CommandRegistry
+}
+
+func newClient(conn *amqp.Connection, channel *amqp.Channel, gs *gamelogic.GameState, gameID string, signer pubsub.Signer, inbox string) *client {
+	c := &client{
+		conn:    conn,
+		channel: channel,
+		gs:      gs,
+		gameID:  gameID,
+		signer:  signer,
+		inbox:   inbox,
+	}
+
+	location := gamelogic.Arg{Name: "location", Complete: gamelogic.CompleteLocations}
+	player := gamelogic.Arg{Name: "player", Complete: gs.CompleteKnownPlayers}
+	message := gamelogic.Arg{Name: "message", Variadic: true}
+
+	c.commands = gamelogic.NewCommandRegistry()
+	c.commands.Register(gamelogic.Command{
+		Name:    "move",
+		Args:    []gamelogic.Arg{location, {Name: "unitID", Variadic: true, Complete: gs.CompleteUnitIDs}},
+		Example: "move asia 1",
+		Run:     c.move,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "spawn",
+		Args:    []gamelogic.Arg{location, {Name: "rank", Complete: gamelogic.CompleteRanks}},
+		Example: "spawn europe infantry",
+		Run:     c.spawn,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "status",
+		Aliases: []string{"st"},
+		Run: func([]string) error {
+			gs.CommandStatus()
+			return nil
+		},
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "propose",
+		Args:    []gamelogic.Arg{player, {Name: "alliance|pact", Complete: gamelogic.CompleteTreaties}},
+		Example: "propose bob alliance",
+		Run:     c.diplomacy,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name: "accept",
+		Args: []gamelogic.Arg{player},
+		Run:  c.diplomacy,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name: "break",
+		Args: []gamelogic.Arg{player},
+		Run:  c.diplomacy,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name: "say",
+		Args: []gamelogic.Arg{message},
+		Run:  c.chat,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name: "ally",
+		Args: []gamelogic.Arg{message},
+		Run:  c.chat,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "whisper",
+		Aliases: []string{"dm"},
+		Args:    []gamelogic.Arg{player, message},
+		Example: "whisper bob meet me in europe",
+		Run:     c.chat,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "stats",
+		Args:    []gamelogic.Arg{{Name: "player", Optional: true, Complete: gs.CompleteKnownPlayers}},
+		Example: "stats bob",
+		Run:     c.stats,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "spam",
+		Args:    []gamelogic.Arg{{Name: "n"}},
+		Example: "spam 5",
+		Run:     c.spam,
+	})
+	c.commands.Register(gamelogic.Command{
+		Name:    "quit",
+		Aliases: []string{"exit"},
+		Run: func([]string) error {
+			gamelogic.PrintQuit()
+			err := c.heartbeat(true)
+			if err != nil {
+				fmt.Printf("couldn't say goodbye: %v\n", err)
+			}
+			return errQuit
+		},
+	})
+	c.commands.Register(gamelogic.Command{
+		Name: "help",
+		Run: func([]string) error {
+			c.commands.PrintHelp()
+			return nil
+		},
+	})
+	return c
+}
+
+// execute runs one command typed by the player or read from a script.
+// It returns errQuit once the player is done.
+func (c *client) execute(input []string) error {
+	pubsub.RecordNote(strings.Join(input, " "))
+	return c.commands.Run(input)
+}
+
+// sendHeartbeats tells the server the player is still there until the
+// program exits.
+func (c *client) sendHeartbeats() {
+	ticker := time.NewTicker(routing.HeartbeatInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		err := c.heartbeat(false)
+		if err != nil {
+			fmt.Printf("couldn't send heartbeat: %v\n", err)
+		}
+	}
+}
+
+func (c *client) heartbeat(leaving bool) error {
+	return pubsub.PublishJSON(
+		c.channel,
+		routing.ExchangePerilTopic,
+		routing.GameKey(c.gameID, routing.PresencePrefix, c.gs.GetUsername()),
+		routing.Heartbeat{CurrentTime: time.Now(), Username: c.gs.GetUsername(), Leaving: leaving},
+		pubsub.WithSignature(c.signer),
+	)
+}
+
+func (c *client) spawn(words []string) error {
+	err := c.gs.CommandSpawn(words)
+	if err != nil {
+		return fmt.Errorf("couldn't spawn unit: %v", err)
+	}
+
+	err = publishStatus(c.channel, c.gs, c.gameID, c.signer, c.inbox)
+	if err != nil {
+		return fmt.Errorf("couldn't publish status: %v", err)
+	}
+	return nil
+}
+
+func (c *client) move(words []string) error {
+	armyMove, err := c.gs.CommandMove(words)
+	if err != nil {
+		return fmt.Errorf("couldn't move: %v", err)
+	}
+
+	err = pubsub.PublishJSON(
+		c.channel,
+		routing.ExchangePerilTopic,
+		routing.GameKey(c.gameID, routing.ArmyMovesPrefix, c.gs.GetUsername()),
+		armyMove,
+		pubsub.WithSignature(c.signer),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't publish move: %v", err)
+	}
+
+	fmt.Println("move was published successfully")
+
+	err = publishStatus(c.channel, c.gs, c.gameID, c.signer, c.inbox)
+	if err != nil {
+		return fmt.Errorf("couldn't publish status: %v", err)
+	}
+	return nil
+}
+
+func (c *client) diplomacy(words []string) error {
+	diplomacy, err := c.gs.CommandDiplomacy(words)
+	if err != nil {
+		return fmt.Errorf("couldn't %s: %v", words[0], err)
+	}
+
+	err = pubsub.PublishJSON(
+		c.channel,
+		routing.ExchangePerilTopic,
+		routing.GameKey(c.gameID, routing.DiplomacyPrefix, c.gs.GetUsername()),
+		diplomacy,
+		pubsub.WithSignature(c.signer),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't publish diplomacy: %v", err)
+	}
+	return nil
+}
+
+func (c *client) chat(words []string) error {
+	msg, err := c.gs.CommandChat(words)
+	if err != nil {
+		return fmt.Errorf("couldn't send message: %v", err)
+	}
+
+	// only the server can bind the key, whispers stay between the players
+	err = pubsub.PublishJSON(
+		c.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(c.gameID, routing.ChatSendPrefix, c.inbox),
+		msg,
+		pubsub.WithSignature(c.signer),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't publish message: %v", err)
+	}
+	return nil
+}
+
+func (c *client) stats(words []string) error {
+	player := c.gs.GetUsername()
+	if len(words) == 2 {
+		player = words[1]
+	}
+
+	stats, err := pubsub.CallJSON[routing.PlayerStats, routing.PlayerStats](
+		c.conn,
+		routing.ExchangePerilTopic,
+		routing.StatsKey,
+		routing.PlayerStats{Username: player},
+		rpcTimeout,
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't get stats: %v", err)
+	}
+	gamelogic.PrintPlayerStats(stats)
+	return nil
+}
+
+func (c *client) spam(words []string) error {
+	n, err := strconv.Atoi(words[1])
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid number of logs to spam: %s", words[1])
+	}
+
+	username := c.gs.GetUsername()
+	for published := 0; published < n; published++ {
+		err = pubsub.PublishGob(
+			c.channel,
+			routing.ExchangePerilTopic,
+			routing.GameKey(c.gameID, routing.GameLogSlug, username),
+			routing.GameLog{
+				CurrentTime: time.Now(),
+				Message:     gamelogic.GetMaliciousLog(),
+				Username:    username,
+				Event:       routing.LogEventMessage,
+				GameID:      c.gameID,
+			},
+			pubsub.WithSignature(c.signer),
+		)
+		if err != nil {
+			return fmt.Errorf("couldn't publish malicious log after %v: %v", published, err)
+		}
+	}
+
+	fmt.Printf("Published %v malicious logs\n", n)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// findMatch asks the server for a game of size players and waits for the
+// room it makes once it found opponents. The subscription stays after, the
+// server also says there when the player times out of the game. Updates
+// come under the player's inbox, so only the server can send them. Waiting
+// longer than timeout, or an interrupt, takes the player out of the queue.
+func findMatch(conn *amqp.Connection, signer pubsub.Signer, keys pubsub.KeyRegistry, inbox string, size int, timeout time.Duration, events *eventLog) (string, error) {
+	username := signer.Username
+	found := make(chan routing.MatchUpdate, 1)
+	queue := routing.MatchUpdatePrefix + "." + inbox
+	err := pubsub.SubscribeJSON(conn, routing.ExchangePerilDirect, queue, queue, 0, handlerMatch(found, events), auth.FromServer[routing.MatchUpdate](keys))
+	if err != nil {
+		return "", fmt.Errorf("couldn't subscribe to matchmaking: %v", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return "", err
+	}
+	defer channel.Close()
+
+	request := func(cancel bool) error {
+		return pubsub.PublishJSON(
+			channel,
+			routing.ExchangePerilTopic,
+			routing.MatchRequestPrefix+"."+username,
+			routing.MatchRequest{CurrentTime: time.Now(), Username: username, Size: size, Cancel: cancel},
+			pubsub.WithSignature(signer),
+		)
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	err = request(false)
+	if err != nil {
+		return "", fmt.Errorf("couldn't ask for a match: %v", err)
+	}
+	fmt.Printf("Looking for a %v-player game, ctrl+c to stop...\n", size)
+
+	var update routing.MatchUpdate
+	select {
+	case update = <-found:
+	case <-interrupts:
+		return "", errors.Join(errors.New("you stopped looking for a game"), request(true))
+	case <-time.After(timeout):
+		return "", errors.Join(fmt.Errorf("no game after %v", timeout), request(true))
+	}
+	if update.State != routing.MatchFound {
+		return "", fmt.Errorf("matchmaking was cancelled: %s", update.Reason)
+	}
+	fmt.Printf("Matched with %s in room %s\n", strings.Join(update.Players, ", "), update.GameID)
+	return update.GameID, nil
+}
+
+func handlerMatch(found chan<- routing.MatchUpdate, events *eventLog) func(routing.MatchUpdate) pubsub.AckType {
+	return func(update routing.MatchUpdate) pubsub.AckType {
+		events.emit("match", map[string]string{
+			"state":   string(update.State),
+			"size":    strconv.Itoa(update.Size),
+			"game":    update.GameID,
+			"players": strings.Join(update.Players, ","),
+			"reason":  update.Reason,
+		})
+
+		switch update.State {
+		case routing.MatchQueued:
+			fmt.Printf("Waiting for a %v-player game: %s\n", update.Size, update.Reason)
+		case routing.MatchFound, routing.MatchCancelled:
+			select {
+			case found <- update:
+			default:
+			}
+		case routing.MatchTimedOut:
+			fmt.Println()
+			fmt.Printf("==== Timed Out of %s ====\n", update.GameID)
+			fmt.Printf("You were removed from the game: %s\n", update.Reason)
+			fmt.Printf("> ")
+		}
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Exit codes of a script run, so whatever runs the scenario can tell what
+// went wrong.
+const (
+	exitOK          = 0
+	exitSetupFailed = 1
+	exitBadScript   = 2
+	exitCommand     = 3
+	exitTimeout     = 4
+	exitExpectation = 5
+)
+
+// scriptEvent is one line of the JSON the client prints in script mode.
+type scriptEvent struct {
+	Time   time.Time
+	Type   string
+	Fields map[string]string `json:",omitempty"`
+}
+
+// eventLog keeps every event of a script run so wait and expect can look
+// back at the ones that came in while a command ran. A nil eventLog, when
+// the client is interactive, drops everything.
+type eventLog struct {
+	out     *json.Encoder
+	events  []scriptEvent
+	next    int
+	changed chan struct{}
+	mu      *sync.Mutex
+}
+
+func newEventLog(w io.Writer) *eventLog {
+	return &eventLog{
+		out:     json.NewEncoder(w),
+		events:  []scriptEvent{},
+		changed: make(chan struct{}),
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (el *eventLog) emit(eventType string, fields map[string]string) {
+	if el == nil {
+		return
+	}
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	event := scriptEvent{Time: time.Now(), Type: eventType, Fields: fields}
+	el.events = append(el.events, event)
+	el.out.Encode(event)
+	close(el.changed)
+	el.changed = make(chan struct{})
+}
+
+// await returns the first event of eventType no earlier wait has
+// returned, waiting up to timeout for it.
+func (el *eventLog) await(eventType string, timeout time.Duration) (scriptEvent, bool) {
+	deadline := time.After(timeout)
+	for {
+		el.mu.Lock()
+		for i := el.next; i < len(el.events); i++ {
+			if el.events[i].Type == eventType {
+				el.next = i + 1
+				el.mu.Unlock()
+				return el.events[i], true
+			}
+		}
+		changed := el.changed
+		el.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return scriptEvent{}, false
+		}
+	}
+}
+
+// runScript plays commands from path, or stdin for "-", one per line.
+// Besides the client's commands a script can use:
+//
+//	# a comment
+//	sleep <duration>
+//	wait <event> [timeout]
+//	expect <event> [field=value...] [timeout]
+//
+// wait blocks until the next event of a type, expect also fails unless it
+// has the given fields.
+func runScript(c *client, events *eventLog, path string, timeout time.Duration) int {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			events.emit("error", map[string]string{"error": err.Error()})
+			return exitBadScript
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		code, err := runScriptLine(c, events, strings.Fields(line), timeout)
+		if errors.Is(err, errQuit) {
+			return exitOK
+		}
+		if err != nil {
+			events.emit("error", map[string]string{
+				"line":  fmt.Sprint(lineNumber),
+				"input": line,
+				"error": err.Error(),
+			})
+			return code
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		events.emit("error", map[string]string{"error": err.Error()})
+		return exitBadScript
+	}
+	return exitOK
+}
+
+func runScriptLine(c *client, events *eventLog, words []string, timeout time.Duration) (int, error) {
+	switch words[0] {
+	case "sleep":
+		if len(words) != 2 {
+			return exitBadScript, errors.New("usage: sleep <duration>")
+		}
+		d, err := time.ParseDuration(words[1])
+		if err != nil {
+			return exitBadScript, err
+		}
+		time.Sleep(d)
+		return exitOK, nil
+
+	case "wait", "expect":
+		if len(words) < 2 {
+			return exitBadScript, fmt.Errorf("usage: %s <event> [field=value...] [timeout]", words[0])
+		}
+
+		args := words[2:]
+		if len(args) > 0 && !strings.Contains(args[len(args)-1], "=") {
+			d, err := time.ParseDuration(args[len(args)-1])
+			if err != nil {
+				return exitBadScript, err
+			}
+			timeout = d
+			args = args[:len(args)-1]
+		}
+		if words[0] == "wait" && len(args) > 0 {
+			return exitBadScript, errors.New("usage: wait <event> [timeout]")
+		}
+
+		event, ok := events.await(words[1], timeout)
+		if !ok {
+			return exitTimeout, fmt.Errorf("no %s event within %v", words[1], timeout)
+		}
+
+		for _, arg := range args {
+			field, value, _ := strings.Cut(arg, "=")
+			if event.Fields[field] != value {
+				return exitExpectation, fmt.Errorf("expected %s=%s, got %q", field, value, event.Fields[field])
+			}
+		}
+		return exitOK, nil
+	}
+
+	err := c.execute(words)
+	if err != nil && !errors.Is(err, errQuit) {
+		return exitCommand, err
+	}
+	events.emit("command", map[string]string{"input": strings.Join(words, " ")})
+	return exitOK, err
+}
+
+func moveOutcomeName(outcome gamelogic.MoveOutcome) string {
+	switch outcome {
+	case gamelogic.MoveOutcomeSamePlayer:
+		return "own"
+	case gamelogic.MoveOutcomeMakeWar:
+		return "war"
+	}
+	return "safe"
+}
+
+// emitWar is the war event both sides of a war get, for scripts to wait
+// for the outcome.
+func emitWar(events *eventLog, rw gamelogic.RecognitionOfWar, outcome gamelogic.WarOutcome, winner, loser string) {
+	events.emit("war", map[string]string{
+		"attacker": rw.Attacker.Username,
+		"defender": rw.Defender.Username,
+		"location": string(rw.Location()),
+		"outcome":  warOutcomeName(outcome),
+		"winner":   winner,
+		"loser":    loser,
+	})
+}
+
+func warOutcomeName(outcome gamelogic.WarOutcome) string {
+	switch outcome {
+	case gamelogic.WarOutcomeYouWon:
+		return "won"
+	case gamelogic.WarOutcomeOpponentWon:
+		return "lost"
+	case gamelogic.WarOutcomeDraw:
+		return "draw"
+	}
+	return "none"
+}
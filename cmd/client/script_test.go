@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func testPlayer(t *testing.T, username string, spawns ...[]string) *gamelogic.GameState {
+	t.Helper()
+	gs := gamelogic.NewGameState(username)
+	gs.HandleLifecycle(routing.GameLifecycle{Phase: routing.GamePhaseStarted, Players: []string{"attacker", "defender"}})
+	for _, spawn := range spawns {
+		err := gs.CommandSpawn(append([]string{"spawn"}, spawn...))
+		if err != nil {
+			t.Fatalf("couldn't spawn %v: %v", spawn, err)
+		}
+	}
+	return gs
+}
+
+func testScript(t *testing.T, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script")
+	err := os.WriteFile(path, []byte(lines), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The defender recognizes the war and resolves it first, its script has
+// to see the outcome the war event reports.
+func TestScriptExpectsDefendersWar(t *testing.T) {
+	attacker := testPlayer(t, "attacker", []string{"europe", "artillery"}, []string{"europe", "artillery"})
+	defender := testPlayer(t, "defender", []string{"europe", "infantry"})
+
+	move, err := attacker.CommandMove([]string{"move", "europe", "1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome := defender.HandleMove(move); outcome != gamelogic.MoveOutcomeMakeWar {
+		t.Fatalf("the move made no war: %v", outcome)
+	}
+
+	events := newEventLog(io.Discard)
+	rw := defender.RecognizeWar(move)
+	go func() {
+		// the war comes in while the script already waits for it
+		time.Sleep(10 * time.Millisecond)
+		outcome, winner, loser := defender.HandleWar(rw)
+		emitWar(events, rw, outcome, winner, loser)
+	}()
+
+	path := testScript(t, `# the defender's side of a war
+expect war outcome=lost winner=attacker loser=defender location=europe 1s
+`)
+	code := runScript(nil, events, path, time.Second)
+	if code != exitOK {
+		t.Fatalf("expect exited with %v", code)
+	}
+}
+
+func TestScriptExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		events map[string]string
+		code   int
+	}{
+		{"matching", "expect war outcome=won", map[string]string{"outcome": "won"}, exitOK},
+		{"wrong field", "expect war outcome=won", map[string]string{"outcome": "draw"}, exitExpectation},
+		{"no event", "wait war 10ms", nil, exitTimeout},
+		{"bad timeout", "wait war soon", nil, exitBadScript},
+		{"fields on wait", "wait war outcome=won", nil, exitBadScript},
+		{"bad sleep", "sleep", nil, exitBadScript},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := newEventLog(io.Discard)
+			if test.events != nil {
+				events.emit("war", test.events)
+			}
+			code := runScript(nil, events, testScript(t, test.script+"\n"), 10*time.Millisecond)
+			if code != test.code {
+				t.Fatalf("got exit code %v, want %v", code, test.code)
+			}
+		})
+	}
+}
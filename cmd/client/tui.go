@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	tuiEventsSize   = 500
+	tuiSideWidth    = 40
+	tuiRefreshEvery = time.Second
+)
+
+// tui is the full-screen client. Everything the game prints, from the
+// handlers or the commands, ends up in the event pane instead of on top of
+// what the player is typing.
+type tui struct {
+	screen     tcell.Screen
+	gs         *gamelogic.GameState
+	gameID     string
+	commands   *gamelogic.CommandRegistry
+	events     []string
+	input      []rune
+	cursor     int
+	history    []string
+	historyPos int
+	lines      chan []string
+	stdout     *os.File
+	mu         *sync.Mutex
+}
+
+func newTUI(gs *gamelogic.GameState, gameID string, commands *gamelogic.CommandRegistry) (*tui, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the terminal: %v", err)
+	}
+	err = screen.Init()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't set up the terminal: %v", err)
+	}
+
+	t := &tui{
+		screen:   screen,
+		gs:       gs,
+		gameID:   gameID,
+		commands: commands,
+		events:   []string{},
+		lines:    make(chan []string),
+		stdout:   os.Stdout,
+		mu:       &sync.Mutex{},
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		screen.Fini()
+		return nil, fmt.Errorf("couldn't capture the game output: %v", err)
+	}
+	os.Stdout = w
+	go t.capture(r)
+
+	go t.handleKeys()
+	go func() {
+		for range time.Tick(tuiRefreshEvery) {
+			t.draw()
+		}
+	}()
+	t.draw()
+	return t, nil
+}
+
+func (t *tui) close() {
+	t.screen.Fini()
+	os.Stdout = t.stdout
+}
+
+// readInput blocks until the player submits a line, like
+// gamelogic.GetInput does for the plain client.
+func (t *tui) readInput() []string {
+	return <-t.lines
+}
+
+// Write lets the tui stand in for the log output too.
+func (t *tui) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.addEvent(line)
+	}
+	return len(p), nil
+}
+
+func (t *tui) capture(r *os.File) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Handlers print a prompt after their output, there's no use
+		// for it here.
+		line := scanner.Text()
+		for strings.HasPrefix(line, "> ") {
+			line = strings.TrimPrefix(line, "> ")
+		}
+		t.addEvent(line)
+	}
+}
+
+func (t *tui) addEvent(line string) {
+	t.mu.Lock()
+	t.events = append(t.events, line)
+	if len(t.events) > tuiEventsSize {
+		t.events = t.events[len(t.events)-tuiEventsSize:]
+	}
+	t.mu.Unlock()
+	t.draw()
+}
+
+func (t *tui) handleKeys() {
+	for {
+		switch ev := t.screen.PollEvent().(type) {
+		case nil:
+			return
+		case *tcell.EventResize:
+			t.screen.Sync()
+			t.draw()
+		case *tcell.EventKey:
+			t.handleKey(ev)
+		}
+	}
+}
+
+func (t *tui) handleKey(ev *tcell.EventKey) {
+	t.mu.Lock()
+
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		line := strings.TrimSpace(string(t.input))
+		t.input = []rune{}
+		t.cursor = 0
+		if line == "" {
+			break
+		}
+		t.history = append(t.history, line)
+		t.historyPos = len(t.history)
+		t.events = append(t.events, "> "+line)
+		t.mu.Unlock()
+		t.draw()
+		t.lines <- strings.Fields(line)
+		return
+	case tcell.KeyCtrlC, tcell.KeyCtrlD:
+		t.mu.Unlock()
+		t.lines <- []string{"quit"}
+		return
+	case tcell.KeyUp:
+		if t.historyPos > 0 {
+			t.historyPos--
+			t.input = []rune(t.history[t.historyPos])
+			t.cursor = len(t.input)
+		}
+	case tcell.KeyDown:
+		if t.historyPos < len(t.history) {
+			t.historyPos++
+			t.input = []rune{}
+			if t.historyPos < len(t.history) {
+				t.input = []rune(t.history[t.historyPos])
+			}
+			t.cursor = len(t.input)
+		}
+	case tcell.KeyLeft:
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case tcell.KeyRight:
+		if t.cursor < len(t.input) {
+			t.cursor++
+		}
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		t.cursor = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		t.cursor = len(t.input)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if t.cursor > 0 {
+			t.input = append(t.input[:t.cursor-1], t.input[t.cursor:]...)
+			t.cursor--
+		}
+	case tcell.KeyDelete:
+		if t.cursor < len(t.input) {
+			t.input = append(t.input[:t.cursor], t.input[t.cursor+1:]...)
+		}
+	case tcell.KeyTab:
+		t.complete()
+	case tcell.KeyRune:
+		t.input = append(t.input[:t.cursor], append([]rune{ev.Rune()}, t.input[t.cursor:]...)...)
+		t.cursor++
+	}
+
+	t.mu.Unlock()
+	t.draw()
+}
+
+// complete finishes the word under the cursor as far as it's unambiguous,
+// going by the commands' args, and lists the options when there are
+// several. Must be called with the lock held.
+func (t *tui) complete() {
+	before := string(t.input[:t.cursor])
+	words := strings.Fields(before)
+	if len(words) == 0 || strings.HasSuffix(before, " ") {
+		words = append(words, "")
+	}
+	prefix := words[len(words)-1]
+
+	candidates := []string{}
+	for _, candidate := range t.commands.Complete(words[:len(words)-1]) {
+		if strings.HasPrefix(candidate, prefix) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	completion := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		completion += " "
+	} else {
+		t.events = append(t.events, strings.Join(candidates, "  "))
+	}
+
+	insert := []rune(strings.TrimPrefix(completion, prefix))
+	t.input = append(t.input[:t.cursor], append(insert, t.input[t.cursor:]...)...)
+	t.cursor += len(insert)
+}
+
+func (t *tui) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.screen.Clear()
+	width, height := t.screen.Size()
+	if width < tuiSideWidth+20 || height < 10 {
+		drawText(t.screen, 0, 0, width, tcell.StyleDefault, "terminal too small")
+		t.screen.Show()
+		return
+	}
+
+	player := t.gs.GetPlayerSnap()
+	title := fmt.Sprintf(" Peril - %s in %s - %v unit(s) ", player.Username, t.gameID, len(player.Units))
+	drawText(t.screen, 0, 0, width, tcell.StyleDefault.Reverse(true), title+strings.Repeat(" ", max(width-len(title), 0)))
+
+	locations := gamelogic.GetLocations()
+	mapHeight := len(locations) + 2
+	t.drawMap(player, 0, 1, tuiSideWidth, mapHeight)
+	t.drawUnits(player, 0, 1+mapHeight, tuiSideWidth, height-2-mapHeight)
+	t.drawEvents(tuiSideWidth, 1, width-tuiSideWidth, height-2)
+
+	prompt := "> "
+	drawText(t.screen, 0, height-1, width, tcell.StyleDefault, prompt+string(t.input))
+	t.screen.ShowCursor(len(prompt)+t.cursor, height-1)
+	t.screen.Show()
+}
+
+// drawMap shows our units per territory next to the enemies we last saw
+// there.
+func (t *tui) drawMap(player gamelogic.Player, x, y, width, height int) {
+	drawBox(t.screen, x, y, width, height, "Map")
+
+	enemies := map[gamelogic.Location][]string{}
+	for _, sighting := range t.gs.GetSightingsSnap() {
+		enemies[sighting.Location] = append(enemies[sighting.Location], fmt.Sprintf("%s:%v", sighting.Username, len(sighting.Units)))
+	}
+
+	for i, location := range gamelogic.GetLocations() {
+		own := 0
+		for _, unit := range player.Units {
+			if unit.Location == location {
+				own++
+			}
+		}
+		sort.Strings(enemies[location])
+
+		style := tcell.StyleDefault
+		if own > 0 && len(enemies[location]) > 0 {
+			style = style.Foreground(tcell.ColorRed)
+		} else if own > 0 {
+			style = style.Foreground(tcell.ColorGreen)
+		}
+		line := fmt.Sprintf("%-10s you:%-3v %s", location, own, strings.Join(enemies[location], " "))
+		drawText(t.screen, x+1, y+1+i, width-2, style, line)
+	}
+}
+
+func (t *tui) drawUnits(player gamelogic.Player, x, y, width, height int) {
+	drawBox(t.screen, x, y, width, height, "Units")
+	for i, unit := range sortedUnits(player) {
+		if i >= height-2 {
+			break
+		}
+		drawText(t.screen, x+1, y+1+i, width-2, tcell.StyleDefault, fmt.Sprintf("#%-4v %-10s %s", unit.ID, unit.Rank, unit.Location))
+	}
+}
+
+// drawEvents wraps the latest events to fit, newest at the bottom.
+func (t *tui) drawEvents(x, y, width, height int) {
+	drawBox(t.screen, x, y, width, height, "Events")
+
+	rows := []string{}
+	for i := len(t.events) - 1; i >= 0 && len(rows) < height-2; i-- {
+		wrapped := wrap(t.events[i], width-2)
+		for j := len(wrapped) - 1; j >= 0 && len(rows) < height-2; j-- {
+			rows = append(rows, wrapped[j])
+		}
+	}
+	for i, row := range rows {
+		drawText(t.screen, x+1, y+height-2-i, width-2, tcell.StyleDefault, row)
+	}
+}
+
+func drawBox(screen tcell.Screen, x, y, width, height int, title string) {
+	for col := x; col < x+width; col++ {
+		screen.SetContent(col, y, tcell.RuneHLine, nil, tcell.StyleDefault)
+		screen.SetContent(col, y+height-1, tcell.RuneHLine, nil, tcell.StyleDefault)
+	}
+	for row := y; row < y+height; row++ {
+		screen.SetContent(x, row, tcell.RuneVLine, nil, tcell.StyleDefault)
+		screen.SetContent(x+width-1, row, tcell.RuneVLine, nil, tcell.StyleDefault)
+	}
+	screen.SetContent(x, y, tcell.RuneULCorner, nil, tcell.StyleDefault)
+	screen.SetContent(x+width-1, y, tcell.RuneURCorner, nil, tcell.StyleDefault)
+	screen.SetContent(x, y+height-1, tcell.RuneLLCorner, nil, tcell.StyleDefault)
+	screen.SetContent(x+width-1, y+height-1, tcell.RuneLRCorner, nil, tcell.StyleDefault)
+	drawText(screen, x+2, y, width-4, tcell.StyleDefault.Bold(true), " "+title+" ")
+}
+
+func drawText(screen tcell.Screen, x, y, width int, style tcell.Style, text string) {
+	col := 0
+	for _, r := range text {
+		if col >= width {
+			return
+		}
+		screen.SetContent(x+col, y, r, nil, style)
+		col++
+	}
+}
+
+func wrap(text string, width int) []string {
+	runes := []rune(strings.ReplaceAll(text, "\t", "    "))
+	if len(runes) == 0 {
+		return []string{""}
+	}
+	rows := []string{}
+	for len(runes) > width {
+		rows = append(rows, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(rows, string(runes))
+}
+
+func sortedUnits(player gamelogic.Player) []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, unit := range player.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	return units
+}
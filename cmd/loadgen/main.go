@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/bot"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const rpcTimeout = 5 * time.Second
+
+type loadConfig struct {
+	broker     config.Broker
+	serverKey  string
+	gameID     string
+	players    int
+	strategy   string
+	rate       float64
+	duration   time.Duration
+	reportRate time.Duration
+	seed       int64
+	password   string
+	keysDir    string
+}
+
+// The virtual players are bots playing through the same game logic and
+// routing as real clients, so they have to play in a room of their own.
+// The latencies are from a publish to each virtual player's handler.
+func main() {
+	cfg := loadConfig{}
+	configFlags := config.RegisterFlags(flag.CommandLine, false)
+	flag.StringVar(&cfg.gameID, "room", "loadgen", "started game room to generate load in, it can't be the default room")
+	flag.IntVar(&cfg.players, "players", 10, "number of virtual players")
+	flag.StringVar(&cfg.strategy, "strategy", "random", "virtual player strategy: random, aggressive or turtle")
+	flag.Float64Var(&cfg.rate, "rate", 2, "turns per second per player")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to generate load for")
+	flag.DurationVar(&cfg.reportRate, "report", 5*time.Second, "how often to print throughput and latency")
+	flag.Int64Var(&cfg.seed, "seed", time.Now().UnixNano(), "seed for the virtual players' decisions")
+	flag.StringVar(&cfg.password, "password", "peril-loadgen", "password the virtual players log in or register with")
+	flag.StringVar(&cfg.keysDir, "keys-dir", ".", "directory keeping the virtual players' signing keys")
+	flag.Parse()
+
+	loaded, err := configFlags.Load()
+	if err != nil {
+		log.Fatalf("couldn't load config: %v", err)
+	}
+	cfg.broker = loaded.Broker
+	cfg.serverKey = loaded.Keys.Server
+
+	if cfg.players < 1 || cfg.rate <= 0 {
+		log.Fatalf("need at least one player and a positive turn rate")
+	}
+	if cfg.gameID == "main" {
+		log.Fatalf("won't generate load in the main room, create a room for it on the server")
+	}
+
+	log.Println("Connecting to rabbitMq server...")
+
+	conn, err := cfg.broker.Dial()
+	if err != nil {
+		log.Fatalf("couldnt dial connection with %s: %v\n", cfg.broker.URL, err)
+	}
+	defer conn.Close()
+
+	err = checkRoom(conn, cfg.gameID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := auth.NewRemoteKeyRegistry(conn, cfg.serverKey)
+	if err != nil {
+		log.Fatalf("couldn't subscribe to key changes: %v", err)
+	}
+
+	log.Printf("Starting %v virtual players in %s for %v...", cfg.players, cfg.gameID, cfg.duration)
+
+	// the game output of every player would drown the report
+	report := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err == nil {
+		os.Stdout = devNull
+	}
+
+	stats := newLatencyStats()
+	tracker := newDeliveryTracker(cfg.gameID, cfg.players, stats)
+	done := make(chan struct{})
+	for i := 0; i < cfg.players; i++ {
+		b, err := newVirtualPlayer(conn, keys, cfg, fmt.Sprintf("loadgen-%d", i), cfg.seed+int64(i), tracker)
+		if err != nil {
+			log.Fatalf("couldn't create virtual player: %v", err)
+		}
+		go b.Run(time.Duration(float64(time.Second)/cfg.rate), done)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(cfg.reportRate)
+	defer ticker.Stop()
+	timeout := time.After(cfg.duration)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			stats.print(report)
+		case <-timeout:
+			break loop
+		case <-sigChan:
+			break loop
+		}
+	}
+
+	close(done)
+	// give what's still on the way a moment to arrive
+	time.Sleep(time.Second)
+	for action, count := range tracker.undelivered() {
+		stats.failN(action, count)
+	}
+	stats.print(report)
+
+	log.Println("Peril load generator stopped.")
+}
+
+func checkRoom(conn *amqp.Connection, gameID string) error {
+	rooms, err := pubsub.CallJSON[struct{}, []routing.RoomInfo](
+		conn,
+		routing.ExchangePerilTopic,
+		routing.RoomsListKey,
+		struct{}{},
+		rpcTimeout,
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't list game rooms: %v", err)
+	}
+	for _, room := range rooms {
+		if room.GameID != gameID {
+			continue
+		}
+		if room.Phase != routing.GamePhaseStarted {
+			return fmt.Errorf("room %s is in the %s phase, start it on the server first", gameID, room.Phase)
+		}
+		return nil
+	}
+	return fmt.Errorf("room %s doesn't exist, create and start it on the server first", gameID)
+}
+
+func newVirtualPlayer(conn *amqp.Connection, keys pubsub.KeyRegistry, cfg loadConfig, username string, seed int64, tracker *deliveryTracker) (*bot.Bot, error) {
+	strategy, err := bot.GetStrategy(cfg.strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := auth.LoginOrRegister(conn, username, cfg.password)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := auth.RegisterSigningKey(conn, session, auth.SigningKeyPath(cfg.keysDir, username))
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := bot.NewAMQPTransport(conn, signer, session.Inbox, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bot.New(username, cfg.gameID, strategy, &timedTransport{Transport: transport, tracker: tracker}, seed)
+	err = b.Start()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type latencyStats struct {
+	latencies map[string][]time.Duration
+	failures  map[string]int
+	started   time.Time
+	mu        *sync.Mutex
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{
+		latencies: map[string][]time.Duration{},
+		failures:  map[string]int{},
+		started:   time.Now(),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (ls *latencyStats) record(action string, latency time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.latencies[action] = append(ls.latencies[action], latency)
+}
+
+func (ls *latencyStats) fail(action string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.failures[action]++
+}
+
+func (ls *latencyStats) failN(action string, count int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.failures[action] += count
+}
+
+func (ls *latencyStats) print(w io.Writer) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	elapsed := time.Since(ls.started)
+	actions := []string{}
+	for action := range ls.latencies {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	fmt.Fprintf(w, "==== Load after %v ====\n", elapsed.Round(time.Second))
+	total := 0
+	for _, action := range actions {
+		latencies := ls.latencies[action]
+		sorted := make([]time.Duration, len(latencies))
+		copy(sorted, latencies)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		total += len(sorted)
+
+		fmt.Fprintf(w,
+			"%-8s %7d msgs %8.1f msg/s  p50 %-10v p90 %-10v p99 %-10v max %-10v failed %d\n",
+			action,
+			len(sorted),
+			float64(len(sorted))/elapsed.Seconds(),
+			percentile(sorted, 50),
+			percentile(sorted, 90),
+			percentile(sorted, 99),
+			percentile(sorted, 100),
+			ls.failures[action],
+		)
+	}
+	fmt.Fprintf(w, "total    %7d msgs %8.1f msg/s\n", total, float64(total)/elapsed.Seconds())
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index].Round(time.Microsecond)
+}
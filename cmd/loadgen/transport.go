@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/bot"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// the messages every virtual player consumes, timed from publish to each
+// delivery
+var timedActions = map[string]string{
+	routing.ArmyMovesPrefix:       "move",
+	routing.WarRecognitionsPrefix: "war",
+}
+
+type inFlight struct {
+	action     string
+	sent       time.Time
+	deliveries int
+}
+
+// deliveryTracker remembers when each timed message was published, by its
+// body, until all the virtual players got it.
+type deliveryTracker struct {
+	gameID    string
+	receivers int
+	stats     *latencyStats
+	messages  map[string]*inFlight
+	mu        *sync.Mutex
+}
+
+func newDeliveryTracker(gameID string, receivers int, stats *latencyStats) *deliveryTracker {
+	return &deliveryTracker{
+		gameID:    gameID,
+		receivers: receivers,
+		stats:     stats,
+		messages:  map[string]*inFlight{},
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (dt *deliveryTracker) action(key string) (string, bool) {
+	prefix, _, _ := strings.Cut(strings.TrimPrefix(key, dt.gameID+"."), ".")
+	action, ok := timedActions[prefix]
+	return action, ok
+}
+
+func (dt *deliveryTracker) sent(action string, body []byte) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.messages[string(body)] = &inFlight{action: action, sent: time.Now()}
+}
+
+func (dt *deliveryTracker) delivered(body []byte) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	msg, ok := dt.messages[string(body)]
+	if !ok {
+		return
+	}
+	dt.stats.record(msg.action, time.Since(msg.sent))
+	msg.deliveries++
+	if msg.deliveries >= dt.receivers {
+		delete(dt.messages, string(body))
+	}
+}
+
+// undelivered counts the timed messages some virtual player never got.
+func (dt *deliveryTracker) undelivered() map[string]int {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	counts := map[string]int{}
+	for _, msg := range dt.messages {
+		counts[msg.action]++
+	}
+	return counts
+}
+
+// timedTransport is a virtual player's transport, reporting to the tracker
+// what it publishes and consumes.
+type timedTransport struct {
+	bot.Transport
+	tracker *deliveryTracker
+}
+
+func (tt *timedTransport) PublishJSON(exchange, key string, val any) error {
+	action, timed := tt.tracker.action(key)
+	if timed {
+		// the broker delivers the same bytes, they identify the message
+		body, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		tt.tracker.sent(action, body)
+	}
+
+	err := tt.Transport.PublishJSON(exchange, key, val)
+	if err != nil && timed {
+		tt.tracker.stats.fail(action)
+	}
+	return err
+}
+
+func (tt *timedTransport) Subscribe(exchange, queueName, key string, handler func([]byte) pubsub.AckType) error {
+	if _, timed := tt.tracker.action(key); !timed {
+		return tt.Transport.Subscribe(exchange, queueName, key, handler)
+	}
+	return tt.Transport.Subscribe(exchange, queueName, key, func(body []byte) pubsub.AckType {
+		tt.tracker.delivered(body)
+		return handler(body)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// replay rebuilds players' game states from recordings made with the
+// client's -record flag, and reports where they stop matching what the
+// players published. The map has to be configured like it was for the
+// game.
+func main() {
+	configFlags := config.RegisterFlags(flag.CommandLine, false)
+	verbose := flag.Bool("v", false, "print every step and what the game printed for it")
+	until := flag.Int64("until", 0, "stop after this record and print the game state, 0 replays everything")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <recording>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	_, err := configFlags.Load()
+	if err != nil {
+		log.Fatalf("couldn't load config: %v", err)
+	}
+
+	// the game prints for players, only -v wants to see it
+	out := os.Stdout
+	if !*verbose {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			log.Fatalf("couldn't open %s: %v", os.DevNull, err)
+		}
+		os.Stdout = devNull
+	}
+
+	diverged := false
+	for _, path := range flag.Args() {
+		divergences, err := replayFile(path, *until, *verbose, out)
+		if err != nil {
+			log.Fatalf("couldn't replay %s: %v", path, err)
+		}
+		if len(divergences) > 0 {
+			diverged = true
+		}
+	}
+
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+func replayFile(path string, until int64, verbose bool, out *os.File) ([]divergence, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta, records, err := pubsub.ReadRecording(f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReplayer(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Replaying %s in %s\n", meta["username"], meta["game"])
+	replayed := 0
+	for _, rec := range records {
+		if until > 0 && rec.Seq > until {
+			break
+		}
+
+		if verbose {
+			fmt.Fprintf(out, "#%v %s %s%s\n", rec.Seq, rec.Direction, rec.RoutingKey, rec.Note)
+		}
+		before := len(r.divergences)
+		r.step(rec)
+		for _, d := range r.divergences[before:] {
+			fmt.Fprintf(out, "#%v %s: %s\n", d.Seq, d.Key, d.Problem)
+		}
+		replayed++
+	}
+
+	if until > 0 {
+		stdout := os.Stdout
+		os.Stdout = out
+		r.gs.CommandStatus()
+		os.Stdout = stdout
+	}
+	fmt.Fprintf(out, "Replayed %v records, %v divergences\n", replayed, len(r.divergences))
+	return r.divergences, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// divergence is a message the player published that doesn't match what
+// the replayed game state would have published at the same point.
+type divergence struct {
+	Seq     int64
+	Key     string
+	Problem string
+}
+
+// replayer rebuilds one player's GameState from their recording: commands
+// they typed and messages they consumed go through the same gamelogic
+// calls the client makes, and every message they published is checked
+// against the rebuilt state.
+type replayer struct {
+	gs     *gamelogic.GameState
+	gameID string
+
+	// what the replay expects the player to publish next
+	commandMove *gamelogic.ArmyMove
+	warLocation gamelogic.Location
+	warLog      *routing.GameLog
+
+	divergences []divergence
+}
+
+func newReplayer(meta map[string]string) (*replayer, error) {
+	if meta["username"] == "" || meta["game"] == "" {
+		return nil, fmt.Errorf("the recording isn't a player's, it has no username or game")
+	}
+
+	// the combat rules come with the room's lifecycle, like they did for
+	// the player
+	gs := gamelogic.NewGameState(meta["username"])
+	return &replayer{gs: gs, gameID: meta["game"]}, nil
+}
+
+func (r *replayer) step(rec pubsub.Record) {
+	var err error
+	switch rec.Direction {
+	case pubsub.DirectionNote:
+		r.command(strings.Fields(rec.Note))
+	case pubsub.DirectionConsume:
+		if rec.Rejected == "" {
+			err = r.consume(rec)
+		}
+	case pubsub.DirectionPublish:
+		err = r.publish(rec)
+	}
+
+	if err != nil {
+		r.diverge(rec, fmt.Sprintf("couldn't decode: %v", err))
+	}
+}
+
+// command redoes the commands that change the game state. The ones that
+// failed then fail again the same way.
+func (r *replayer) command(words []string) {
+	if len(words) == 0 {
+		return
+	}
+
+	switch words[0] {
+	case "spawn":
+		r.gs.CommandSpawn(words)
+	case "move":
+		move, err := r.gs.CommandMove(words)
+		if err == nil {
+			r.commandMove = &move
+		}
+	case "propose", "accept", "break":
+		r.gs.CommandDiplomacy(words)
+	}
+}
+
+func (r *replayer) consume(rec pubsub.Record) error {
+	key := strings.TrimPrefix(rec.RoutingKey, r.gameID+".")
+	switch {
+	case key == routing.PauseKey:
+		ps, err := decodeJSON[routing.PlayingState](rec)
+		if err != nil {
+			return err
+		}
+		r.gs.HandlePause(ps)
+
+	case key == routing.GameLifecycleKey:
+		lc, err := decodeJSON[routing.GameLifecycle](rec)
+		if err != nil {
+			return err
+		}
+		r.gs.HandleLifecycle(lc)
+
+	case strings.HasPrefix(key, routing.ArmyMovesPrefix+"."):
+		move, err := decodeJSON[gamelogic.ArmyMove](rec)
+		if err != nil {
+			return err
+		}
+		if r.gs.HandleMove(move) == gamelogic.MoveOutcomeMakeWar {
+			r.warLocation = move.ToLocation
+		}
+
+	case strings.HasPrefix(key, routing.WarRecognitionsPrefix+"."):
+		rw, err := decodeJSON[gamelogic.RecognitionOfWar](rec)
+		if err != nil {
+			return err
+		}
+		outcome, winner, loser := r.gs.HandleWar(rw)
+		fought := outcome == gamelogic.WarOutcomeYouWon || outcome == gamelogic.WarOutcomeOpponentWon || outcome == gamelogic.WarOutcomeDraw
+		if fought {
+			warLog := r.gs.WarLog(r.gameID, rw, outcome, winner, loser)
+			r.warLog = &warLog
+		}
+
+	case strings.HasPrefix(key, routing.DiplomacyPrefix+"."):
+		d, err := decodeJSON[gamelogic.Diplomacy](rec)
+		if err != nil {
+			return err
+		}
+		r.gs.HandleDiplomacy(d)
+
+	case strings.HasPrefix(key, "chat."):
+		msg, err := decodeJSON[routing.ChatMessage](rec)
+		if err != nil {
+			return err
+		}
+		r.gs.HandleChat(msg)
+	}
+	return nil
+}
+
+func (r *replayer) publish(rec pubsub.Record) error {
+	key := strings.TrimPrefix(rec.RoutingKey, r.gameID+".")
+	switch {
+	case strings.HasPrefix(key, routing.PlayerStatusPrefix+"."):
+		observed, err := decodeJSON[gamelogic.Player](rec)
+		if err != nil {
+			return err
+		}
+		r.divergeUnits(rec, observed.Units, r.gs.GetPlayerSnap().Units)
+
+	case strings.HasPrefix(key, routing.ArmyMovesPrefix+"."):
+		observed, err := decodeJSON[gamelogic.ArmyMove](rec)
+		if err != nil {
+			return err
+		}
+		if r.commandMove == nil {
+			r.diverge(rec, "published a move the replay never made")
+			return nil
+		}
+		replayed := *r.commandMove
+		r.commandMove = nil
+		if observed.ToLocation != replayed.ToLocation {
+			r.diverge(rec, fmt.Sprintf("moved to %s, replayed a move to %s", observed.ToLocation, replayed.ToLocation))
+		}
+		r.divergeUnits(rec, observed.Player.Units, replayed.Player.Units)
+
+	case strings.HasPrefix(key, routing.WarRecognitionsPrefix+"."):
+		observed, err := decodeJSON[gamelogic.RecognitionOfWar](rec)
+		if err != nil {
+			return err
+		}
+		if r.warLocation == "" {
+			r.diverge(rec, "declared a war the replay never saw coming")
+			return nil
+		}
+		r.divergeUnits(rec, observed.Defender.Units, r.gs.GetPlayerSnapAt(r.warLocation).Units)
+		r.warLocation = ""
+
+	case strings.HasPrefix(key, routing.GameLogSlug+"."):
+		observed, err := decodeGob[routing.GameLog](rec)
+		if err != nil {
+			return err
+		}
+		if observed.GetEvent() != routing.LogEventWar {
+			return nil
+		}
+		if r.warLog == nil {
+			r.diverge(rec, fmt.Sprintf("logged a war the replay never fought: %s", observed.Message))
+			return nil
+		}
+		replayed := *r.warLog
+		r.warLog = nil
+		if observed.Message != replayed.Message || observed.Location != replayed.Location {
+			r.diverge(rec, fmt.Sprintf("war in %s: %q, replayed in %s: %q", observed.Location, observed.Message, replayed.Location, replayed.Message))
+		}
+	}
+	return nil
+}
+
+func (r *replayer) diverge(rec pubsub.Record, problem string) {
+	r.divergences = append(r.divergences, divergence{Seq: rec.Seq, Key: rec.RoutingKey, Problem: problem})
+}
+
+// divergeUnits records one divergence per unit that isn't the same in
+// both.
+func (r *replayer) divergeUnits(rec pubsub.Record, observed, replayed map[int]gamelogic.Unit) {
+	ids := []int{}
+	for id := range observed {
+		ids = append(ids, id)
+	}
+	for id := range replayed {
+		if _, ok := observed[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		o, inObserved := observed[id]
+		p, inReplayed := replayed[id]
+		switch {
+		case !inReplayed:
+			r.diverge(rec, fmt.Sprintf("unit %v: %s in %s, missing from the replay", id, o.Rank, o.Location))
+		case !inObserved:
+			r.diverge(rec, fmt.Sprintf("unit %v: missing, replayed %s in %s", id, p.Rank, p.Location))
+		case o != p:
+			r.diverge(rec, fmt.Sprintf("unit %v: %s in %s, replayed %s in %s", id, o.Rank, o.Location, p.Rank, p.Location))
+		}
+	}
+}
+
+func decodeJSON[T any](rec pubsub.Record) (T, error) {
+	var body T
+	err := json.Unmarshal(rec.Body, &body)
+	return body, err
+}
+
+func decodeGob[T any](rec pubsub.Record) (T, error) {
+	var body T
+	err := gob.NewDecoder(bytes.NewReader(rec.Body)).Decode(&body)
+	return body, err
+}
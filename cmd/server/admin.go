@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// adminAPI serves the service over HTTP/JSON, so the server can be driven
+// without its terminal. Every request but the health check needs an
+// "Authorization: Bearer <token>" header.
+type adminAPI struct {
+	svc   *service
+	token string
+}
+
+func serveAdmin(addr, token string, svc *service) {
+	api := &adminAPI{svc: svc, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", api.handleHealth)
+	mux.HandleFunc("GET /rooms", api.authorized(api.handleListRooms))
+	mux.HandleFunc("POST /rooms", api.authorized(api.handleCreateRoom))
+	mux.HandleFunc("GET /rooms/{gameID}", api.authorized(api.handleRoomState))
+	mux.HandleFunc("DELETE /rooms/{gameID}", api.authorized(api.handleCloseRoom))
+	mux.HandleFunc("GET /rooms/{gameID}/players", api.authorized(api.handlePlayers))
+	mux.HandleFunc("POST /rooms/{gameID}/pause", api.authorized(api.handlePause(true)))
+	mux.HandleFunc("POST /rooms/{gameID}/resume", api.authorized(api.handlePause(false)))
+	mux.HandleFunc("POST /rooms/{gameID}/start", api.authorized(api.handleStart))
+	mux.HandleFunc("POST /rooms/{gameID}/end", api.authorized(api.handleEnd))
+	mux.HandleFunc("POST /rooms/{gameID}/players/{username}/{action}", api.authorized(api.handleModerate))
+	mux.HandleFunc("POST /rooms/{gameID}/announcements", api.authorized(api.handleAnnounce))
+	mux.HandleFunc("POST /announcements", api.authorized(api.handleAnnounce))
+	mux.HandleFunc("GET /logs", api.authorized(api.handleLogs))
+	mux.HandleFunc("GET /matchmaking", api.authorized(api.handleMatchQueue))
+	mux.HandleFunc("GET /leaderboard", api.authorized(api.handleLeaderboard))
+	mux.HandleFunc("GET /stats/{username}", api.authorized(api.handleStats))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Serving the admin api on %s", addr)
+		err := server.ListenAndServe()
+		if err != nil {
+			log.Printf("admin api stopped: %v", err)
+		}
+	}()
+}
+
+func (api *adminAPI) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := "Bearer " + api.token
+		if api.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong admin token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (api *adminAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
+	h := api.svc.health()
+	status := http.StatusOK
+	if !h.Broker {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+func (api *adminAPI) handleListRooms(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.svc.listRooms())
+}
+
+func (api *adminAPI) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+	req := struct{ GameID string }{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = api.svc.createRoom(req.GameID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	api.handleRoomStateOf(w, req.GameID, http.StatusCreated)
+}
+
+func (api *adminAPI) handleRoomState(w http.ResponseWriter, r *http.Request) {
+	api.handleRoomStateOf(w, r.PathValue("gameID"), http.StatusOK)
+}
+
+func (api *adminAPI) handleRoomStateOf(w http.ResponseWriter, gameID string, status int) {
+	state, err := api.svc.roomState(gameID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, status, state)
+}
+
+func (api *adminAPI) handleCloseRoom(w http.ResponseWriter, r *http.Request) {
+	err := api.svc.closeRoom(r.PathValue("gameID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *adminAPI) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	standings, err := api.svc.standings(r.PathValue("gameID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, standings)
+}
+
+func (api *adminAPI) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := api.svc.setPaused(r.PathValue("gameID"), paused)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		api.handleRoomState(w, r)
+	}
+}
+
+// handleStart takes optional victory conditions, e.g.
+// {"Territories": 4, "TimeLimit": "10m"}
+func (api *adminAPI) handleStart(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Territories int
+		TimeLimit   string
+	}{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	words := []string{"start", fmt.Sprint(req.Territories)}
+	if req.TimeLimit != "" {
+		words = append(words, req.TimeLimit)
+	}
+	conditions, err := parseVictoryConditions(words)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = api.svc.start(r.PathValue("gameID"), conditions)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	api.handleRoomState(w, r)
+}
+
+func (api *adminAPI) handleEnd(w http.ResponseWriter, r *http.Request) {
+	err := api.svc.end(r.PathValue("gameID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	api.handleRoomState(w, r)
+}
+
+func (api *adminAPI) handleModerate(w http.ResponseWriter, r *http.Request) {
+	err := api.svc.moderate(r.PathValue("gameID"), r.PathValue("action"), r.PathValue("username"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAnnounce takes {"Message": "..."}, for the room in the path or for
+// every room without one.
+func (api *adminAPI) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Message string }{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = api.svc.announce(r.PathValue("gameID"), req.Message)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLogs takes the same filters as the logs command as query
+// parameters, plus format=json|csv.
+func (api *adminAPI) handleLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	query.Del("format")
+
+	words := []string{}
+	for key, values := range query {
+		for _, value := range values {
+			words = append(words, key+"="+value)
+		}
+	}
+	filter, err := parseLogFilter(words)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logs, err := api.svc.queryLogs(filter)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown export format: %s", format))
+		return
+	}
+	err = gamelogic.ExportLogs(w, logs, format)
+	if err != nil {
+		log.Printf("couldn't write logs response: %v", err)
+	}
+}
+
+func (api *adminAPI) handleMatchQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.svc.matchQueue())
+}
+
+func (api *adminAPI) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.svc.leaderboard())
+}
+
+func (api *adminAPI) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := api.svc.playerStats(r.PathValue("username"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnknownRoom), errors.Is(err, errNoStats):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errNoMessage):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, errNoLogsFile):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusConflict, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct{ Error string }{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(val)
+	if err != nil {
+		log.Printf("couldn't write admin api response: %v", err)
+	}
+}
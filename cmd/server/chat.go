@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const chatHistorySize = 50
+
+// chatModerator is the only one that delivers chat. Players send theirs
+// to the server under their inbox, see room.join, and get private chat
+// under it. Everything the server delivers is signed so nobody else can
+// pass for it.
+type chatModerator struct {
+	gameID   string
+	channel  *amqp.Channel
+	signer   pubsub.Signer
+	issuer   *auth.TokenIssuer
+	treaties *treatyTracker
+	muted    map[string]bool
+	kicked   map[string]bool
+	history  []routing.ChatMessage
+	mu       *sync.Mutex
+}
+
+func newChatModerator(gameID string, channel *amqp.Channel, signer pubsub.Signer, issuer *auth.TokenIssuer) *chatModerator {
+	return &chatModerator{
+		gameID:   gameID,
+		channel:  channel,
+		signer:   signer,
+		issuer:   issuer,
+		treaties: newTreatyTracker(),
+		muted:    map[string]bool{},
+		kicked:   map[string]bool{},
+		history:  []routing.ChatMessage{},
+		mu:       &sync.Mutex{},
+	}
+}
+
+func (cm *chatModerator) mute(username string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.muted[username] = true
+}
+
+func (cm *chatModerator) unmute(username string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.muted, username)
+}
+
+func (cm *chatModerator) kick(username string) error {
+	cm.mu.Lock()
+	cm.kicked[username] = true
+	cm.mu.Unlock()
+
+	return cm.notify(username, routing.ChatKick, "you have been kicked from the chat")
+}
+
+func (cm *chatModerator) status(username string) (muted bool, kicked bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.muted[username], cm.kicked[username]
+}
+
+func (cm *chatModerator) remember(msg routing.ChatMessage) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.history = append(cm.history, msg)
+	if len(cm.history) > chatHistorySize {
+		cm.history = cm.history[len(cm.history)-chatHistorySize:]
+	}
+}
+
+func (cm *chatModerator) historySnap() []routing.ChatMessage {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	history := make([]routing.ChatMessage, len(cm.history))
+	copy(history, cm.history)
+	return history
+}
+
+func (cm *chatModerator) notify(username string, channel routing.ChatChannel, message string) error {
+	return cm.deliver(username, routing.ChatMessage{
+		CurrentTime: time.Now(),
+		Channel:     channel,
+		To:          username,
+		Message:     message,
+	})
+}
+
+func (cm *chatModerator) replay(username string) error {
+	for _, msg := range cm.historySnap() {
+		msg.History = true
+		err := cm.deliver(username, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends msg to the player's inbox only.
+func (cm *chatModerator) deliver(username string, msg routing.ChatMessage) error {
+	return pubsub.PublishJSON(
+		cm.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(cm.gameID, routing.ChatInboxPrefix, cm.issuer.Inbox(username)),
+		msg,
+		pubsub.WithSignature(cm.signer),
+	)
+}
+
+func chatHandler(cm *chatModerator) func(msg routing.ChatMessage) pubsub.AckType {
+	return func(msg routing.ChatMessage) pubsub.AckType {
+		muted, kicked := cm.status(msg.From)
+
+		var err error
+		switch {
+		case kicked:
+			err = cm.notify(msg.From, routing.ChatKick, "you have been kicked from the chat")
+		case muted:
+			err = cm.notify(msg.From, routing.ChatSystem, "you are muted")
+		case msg.Channel == routing.ChatGlobal:
+			cm.remember(msg)
+			err = pubsub.PublishJSON(
+				cm.channel,
+				routing.ExchangePerilTopic,
+				routing.GameKey(cm.gameID, routing.ChatGlobalKey),
+				msg,
+				pubsub.WithSignature(cm.signer),
+			)
+		case msg.Channel == routing.ChatAlliance:
+			for _, ally := range cm.treaties.allies(msg.From) {
+				err = errors.Join(err, cm.deliver(ally, msg))
+			}
+		case msg.Channel == routing.ChatDirect:
+			err = cm.deliver(msg.To, msg)
+		default:
+			return pubsub.NackDiscard
+		}
+
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+var (
+	errQuit       = errors.New("quit")
+	errNoRoomUsed = errors.New("no room selected: use <gameID>")
+)
+
+// repl is the server's terminal, a thin layer over the service like the
+// admin api. Most commands act on the room picked with use.
+type repl struct {
+	svc         *service
+	currentRoom string
+	commands    *gamelogic.CommandRegistry
+}
+
+func newREPL(svc *service, currentRoom string) *repl {
+	r := &repl{svc: svc, currentRoom: currentRoom}
+
+	gameID := gamelogic.Arg{Name: "gameID", Complete: r.completeRooms}
+	player := gamelogic.Arg{Name: "player"}
+	message := gamelogic.Arg{Name: "message", Variadic: true}
+	filters := gamelogic.Arg{Name: "filters", Optional: true, Variadic: true, Complete: gamelogic.CompleteWords("player=", "event=", "game=", "since=", "until=")}
+
+	r.commands = gamelogic.NewCommandRegistry()
+	r.commands.Register(gamelogic.Command{
+		Name: "pause",
+		Args: []gamelogic.Arg{{Name: "player", Optional: true}},
+		Help: "pauses the whole room, or only the player",
+		Run:  r.inRoom(r.pause),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "resume",
+		Args: []gamelogic.Arg{{Name: "player", Optional: true}},
+		Help: "resumes the whole room, or only the player",
+		Run:  r.inRoom(r.pause),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "room",
+		Args:    []gamelogic.Arg{{Name: "create|list|close", Complete: gamelogic.CompleteWords("create", "list", "close")}, {Name: "gameID", Optional: true, Complete: r.completeRooms}},
+		Example: "room create g1",
+		Run:     r.room,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "use",
+		Args:    []gamelogic.Arg{gameID},
+		Example: "use g1",
+		Run:     r.use,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "start",
+		Args:    []gamelogic.Arg{{Name: "territories", Optional: true}, {Name: "time-limit", Optional: true}},
+		Example: "start 4 10m",
+		Run:     r.inRoom(r.start),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "end",
+		Run:  r.inRoom(r.end),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "standings",
+		Run:  r.inRoom(r.standings),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "online",
+		Help: "lists the players whose clients are connected",
+		Run:  r.inRoom(r.online),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "mute",
+		Args: []gamelogic.Arg{player},
+		Run:  r.inRoom(r.moderate),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "unmute",
+		Args: []gamelogic.Arg{player},
+		Run:  r.inRoom(r.moderate),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "kick",
+		Args: []gamelogic.Arg{player},
+		Help: "takes the player out of the game and its chat",
+		Run:  r.inRoom(r.moderate),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "announce",
+		Args:    []gamelogic.Arg{message},
+		Help:    "tells everyone in the room",
+		Example: "announce the server restarts in 5 minutes",
+		Run:     r.inRoom(r.announce),
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "broadcast",
+		Args:    []gamelogic.Arg{message},
+		Help:    "tells everyone in every room",
+		Example: "broadcast the server restarts in 5 minutes",
+		Run:     r.announce,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "matchmaking",
+		Help: "lists the players waiting for a match",
+		Run:  r.matchQueue,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "leaderboard",
+		Run: func([]string) error {
+			gamelogic.PrintLeaderboard(r.svc.leaderboard())
+			return nil
+		},
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "logs",
+		Args:    []gamelogic.Arg{filters},
+		Help:    "filters: player=<name> event=<type> game=<gameID> since=<time> until=<time>",
+		Example: "logs player=alice event=war since=1h",
+		Run:     r.logs,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "export",
+		Args:    []gamelogic.Arg{{Name: "csv|json", Complete: gamelogic.CompleteWords("csv", "json")}, {Name: "file"}, filters},
+		Help:    "takes the same filters as logs",
+		Example: "export csv wars.csv event=war game=g1",
+		Run:     r.export,
+	})
+	r.commands.Register(gamelogic.Command{
+		Name:    "quit",
+		Aliases: []string{"exit"},
+		Run: func([]string) error {
+			fmt.Println("Exitting the server...")
+			return errQuit
+		},
+	})
+	r.commands.Register(gamelogic.Command{
+		Name: "help",
+		Run: func([]string) error {
+			r.commands.PrintHelp()
+			return nil
+		},
+	})
+	return r
+}
+
+func (r *repl) completeRooms() []string {
+	gameIDs := []string{}
+	for _, info := range r.svc.listRooms() {
+		gameIDs = append(gameIDs, info.GameID)
+	}
+	return gameIDs
+}
+
+func (r *repl) inRoom(run func(words []string) error) func(words []string) error {
+	return func(words []string) error {
+		if r.currentRoom == "" {
+			return errNoRoomUsed
+		}
+		return run(words)
+	}
+}
+
+func (r *repl) room(words []string) error {
+	switch {
+	case words[1] == "list" && len(words) == 2:
+		for _, info := range r.svc.listRooms() {
+			fmt.Printf("* %s (%s, %v players)\n", info.GameID, info.Phase, info.Players)
+		}
+	case words[1] == "create" && len(words) == 3:
+		err := r.svc.createRoom(words[2])
+		if err != nil {
+			return fmt.Errorf("couldn't create room: %v", err)
+		}
+		fmt.Printf("Room %s created\n", words[2])
+	case words[1] == "close" && len(words) == 3:
+		err := r.svc.closeRoom(words[2])
+		if err != nil {
+			return fmt.Errorf("couldn't close room: %v", err)
+		}
+		if r.currentRoom == words[2] {
+			r.currentRoom = ""
+		}
+		fmt.Printf("Room %s closed\n", words[2])
+	default:
+		return fmt.Errorf("%w: room <create|list|close> [gameID]", gamelogic.ErrInvalidArgs)
+	}
+	return nil
+}
+
+func (r *repl) use(words []string) error {
+	_, err := r.svc.room(words[1])
+	if err != nil {
+		return err
+	}
+	r.currentRoom = words[1]
+	fmt.Printf("Using room %s\n", r.currentRoom)
+	return nil
+}
+
+func (r *repl) pause(words []string) error {
+	if len(words) == 2 {
+		fmt.Printf("Sending %s message to %s in %s...\n", words[0], words[1], r.currentRoom)
+		err := r.svc.setPlayerPaused(r.currentRoom, words[1], words[0] == "pause")
+		if err != nil {
+			return fmt.Errorf("couldn't %s %s: %v", words[0], words[1], err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Sending %s message to %s...\n", words[0], r.currentRoom)
+	err := r.svc.setPaused(r.currentRoom, words[0] == "pause")
+	if err != nil {
+		return fmt.Errorf("couldn't %s the game: %v", words[0], err)
+	}
+	return nil
+}
+
+// announce sends the rest of the line to the room in use, or to every room
+// for broadcast.
+func (r *repl) announce(words []string) error {
+	gameID := r.currentRoom
+	if words[0] == "broadcast" {
+		gameID = ""
+	}
+	err := r.svc.announce(gameID, strings.Join(words[1:], " "))
+	if err != nil {
+		return fmt.Errorf("couldn't %s: %v", words[0], err)
+	}
+	return nil
+}
+
+func (r *repl) start(words []string) error {
+	conditions, err := parseVictoryConditions(words)
+	if err != nil {
+		return fmt.Errorf("%w: %v", gamelogic.ErrInvalidArgs, err)
+	}
+
+	err = r.svc.start(r.currentRoom, conditions)
+	if err != nil {
+		return fmt.Errorf("couldn't start the game: %v", err)
+	}
+	fmt.Printf("Game started, win by: %s\n", conditions)
+	return nil
+}
+
+func (r *repl) end(words []string) error {
+	err := r.svc.end(r.currentRoom)
+	if err != nil {
+		return fmt.Errorf("couldn't end the game: %v", err)
+	}
+	return nil
+}
+
+func (r *repl) standings(words []string) error {
+	standings, err := r.svc.standings(r.currentRoom)
+	if err != nil {
+		return fmt.Errorf("couldn't get the standings: %v", err)
+	}
+	gamelogic.PrintStandings(standings)
+	return nil
+}
+
+func (r *repl) online(words []string) error {
+	online, err := r.svc.online(r.currentRoom)
+	if err != nil {
+		return err
+	}
+	if len(online) == 0 {
+		fmt.Printf("Nobody is online in %s\n", r.currentRoom)
+		return nil
+	}
+	fmt.Printf("Online in %s: %s\n", r.currentRoom, strings.Join(online, ", "))
+	return nil
+}
+
+func (r *repl) moderate(words []string) error {
+	err := r.svc.moderate(r.currentRoom, words[0], words[1])
+	if err != nil {
+		return fmt.Errorf("couldn't %s %s: %v", words[0], words[1], err)
+	}
+	done := map[string]string{"mute": "muted", "unmute": "unmuted", "kick": "kicked from the game", "pause": "paused", "resume": "resumed"}
+	fmt.Printf("%s has been %s\n", words[1], done[words[0]])
+	return nil
+}
+
+func (r *repl) matchQueue(words []string) error {
+	waiting := r.svc.matchQueue()
+	if len(waiting) == 0 {
+		fmt.Println("Nobody is waiting for a match")
+		return nil
+	}
+	for _, queued := range waiting {
+		fmt.Printf("* %s: %v players, skill %.2f, waiting %v\n", queued.Username, queued.Size, queued.Skill, time.Since(queued.QueuedAt).Round(time.Second))
+	}
+	return nil
+}
+
+func (r *repl) logs(words []string) error {
+	err := queryLogs(r.svc, words[1:])
+	if err != nil {
+		return fmt.Errorf("couldn't query logs: %v", err)
+	}
+	return nil
+}
+
+func (r *repl) export(words []string) error {
+	err := exportLogs(r.svc, words[1], words[2], words[3:])
+	if err != nil {
+		return fmt.Errorf("couldn't export logs: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,700 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logsink"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const victoryCheckInterval = time.Second
+
+// matched games have no territory goal, the one with the best score after
+// matchTimeLimit wins
+const matchTimeLimit = 15 * time.Minute
+
+type gameLifecycle struct {
+	gameID     string
+	combat     string
+	channel    *amqp.Channel
+	signer     pubsub.Signer
+	issuer     *auth.TokenIssuer
+	logs       logsink.LogSink
+	stats      *statsTracker
+	phase      routing.GamePhase
+	conditions gamelogic.VictoryConditions
+	startedAt  time.Time
+	players    map[string]gamelogic.Player
+	reported   map[string]gamelogic.Player
+	fielded    map[string]bool
+	closed     bool
+	paused     bool
+	held       map[string]bool
+
+	// closed the first time the game is over
+	over chan struct{}
+
+	// only set for rooms made by matchmaking
+	matched     map[string]bool
+	matchedAt   time.Time
+	idleTimeout time.Duration
+	lastActive  map[string]time.Time
+	forfeited   map[string]bool
+
+	mu *sync.Mutex
+}
+
+func newGameLifecycle(gameID, combat string, channel *amqp.Channel, signer pubsub.Signer, issuer *auth.TokenIssuer, logs logsink.LogSink, stats *statsTracker) *gameLifecycle {
+	gl := &gameLifecycle{
+		gameID:     gameID,
+		combat:     combat,
+		channel:    channel,
+		signer:     signer,
+		issuer:     issuer,
+		logs:       logs,
+		stats:      stats,
+		phase:      routing.GamePhaseLobby,
+		players:    map[string]gamelogic.Player{},
+		reported:   map[string]gamelogic.Player{},
+		fielded:    map[string]bool{},
+		held:       map[string]bool{},
+		over:       make(chan struct{}),
+		matched:    map[string]bool{},
+		lastActive: map[string]time.Time{},
+		forfeited:  map[string]bool{},
+		mu:         &sync.Mutex{},
+	}
+
+	go func() {
+		ticker := time.NewTicker(victoryCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if gl.isClosed() {
+				return
+			}
+			gl.checkIdle()
+			gl.checkVictory()
+		}
+	}()
+
+	return gl
+}
+
+func (gl *gameLifecycle) close() error {
+	gl.mu.Lock()
+	phase := gl.phase
+	gl.closed = true
+	gl.mu.Unlock()
+
+	switch phase {
+	case routing.GamePhaseStarted:
+		return gl.end("", "the room was closed")
+	case routing.GamePhaseOver:
+		// the players already know
+		return nil
+	}
+
+	gl.mu.Lock()
+	gl.setOver()
+	gl.mu.Unlock()
+
+	return gl.publish(routing.GameLifecycle{
+		CurrentTime: time.Now(),
+		Phase:       routing.GamePhaseOver,
+		Players:     gl.playerNames(),
+		Reason:      "the room was closed",
+	})
+}
+
+// setOver must be called with the lock held.
+func (gl *gameLifecycle) setOver() {
+	gl.phase = routing.GamePhaseOver
+	select {
+	case <-gl.over:
+	default:
+		close(gl.over)
+	}
+}
+
+// done is closed once the game is over.
+func (gl *gameLifecycle) done() <-chan struct{} {
+	return gl.over
+}
+
+func (gl *gameLifecycle) isClosed() bool {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	return gl.closed
+}
+
+func (gl *gameLifecycle) info() routing.RoomInfo {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	return routing.RoomInfo{GameID: gl.gameID, Phase: gl.phase, Combat: gl.combat, Players: len(gl.players)}
+}
+
+// roomState is what the admin api shows of a room.
+type roomState struct {
+	GameID      string
+	Phase       routing.GamePhase
+	Paused      bool
+	Held        []string
+	Players     []string
+	Online      []string
+	Territories int
+	TimeLimit   time.Duration
+	StartedAt   time.Time
+	Standings   []routing.Standing
+}
+
+func (gl *gameLifecycle) state() roomState {
+	gl.mu.Lock()
+	state := roomState{
+		GameID:      gl.gameID,
+		Phase:       gl.phase,
+		Paused:      gl.paused,
+		Territories: gl.conditions.Territories,
+		TimeLimit:   gl.conditions.TimeLimit,
+		StartedAt:   gl.startedAt,
+		Standings:   gamelogic.GetStandings(gl.players),
+		Held:        []string{},
+	}
+	for username := range gl.held {
+		state.Held = append(state.Held, username)
+	}
+	gl.mu.Unlock()
+
+	sort.Strings(state.Held)
+	state.Players = gl.playerNames()
+	return state
+}
+
+func (gl *gameLifecycle) setPaused(paused bool) error {
+	gl.mu.Lock()
+	gl.paused = paused
+	gl.mu.Unlock()
+
+	return pubsub.PublishJSON(
+		gl.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(gl.gameID, routing.PauseKey),
+		routing.PlayingState{IsPaused: paused},
+		pubsub.WithSignature(gl.signer),
+	)
+}
+
+// setPlayerPaused pauses or resumes a single player, leaving the rest of
+// the room playing.
+func (gl *gameLifecycle) setPlayerPaused(username string, paused bool) error {
+	gl.mu.Lock()
+	if _, ok := gl.players[username]; !ok {
+		gl.mu.Unlock()
+		return fmt.Errorf("%s isn't playing in %s", username, gl.gameID)
+	}
+	if paused {
+		gl.held[username] = true
+	} else {
+		delete(gl.held, username)
+		gl.lastActive[username] = time.Now()
+	}
+	gl.mu.Unlock()
+
+	action := routing.PlayerResume
+	if paused {
+		action = routing.PlayerPause
+	}
+	return gl.publishControl(routing.PlayerControl{
+		CurrentTime: time.Now(),
+		Action:      action,
+		Username:    username,
+	})
+}
+
+// kick takes a player out of the game for good, like a timeout does. The
+// last one left wins.
+func (gl *gameLifecycle) kick(username string) error {
+	gl.mu.Lock()
+	if _, ok := gl.players[username]; !ok {
+		gl.mu.Unlock()
+		return fmt.Errorf("%s isn't playing in %s", username, gl.gameID)
+	}
+	delete(gl.players, username)
+	delete(gl.fielded, username)
+	delete(gl.held, username)
+	gl.forfeited[username] = true
+	started := gl.phase == routing.GamePhaseStarted
+	abandoned := !started && len(gl.matched) > 0 && len(gl.forfeited) == len(gl.matched)
+	if abandoned {
+		gl.setOver()
+	}
+	gl.mu.Unlock()
+
+	reason := "kicked by the server"
+	fmt.Printf("%s was kicked from %s\n", username, gl.gameID)
+	err := gl.logs.Write(routing.GameLog{
+		CurrentTime: time.Now(),
+		Message:     fmt.Sprintf("%s was kicked from game %s", username, gl.gameID),
+		Username:    username,
+		Event:       routing.LogEventLifecycle,
+		GameID:      gl.gameID,
+		Outcome:     "kicked",
+	})
+	if err != nil {
+		fmt.Printf("couldn't log %s's kick: %v\n", username, err)
+	}
+
+	err = gl.publishControl(routing.PlayerControl{
+		CurrentTime: time.Now(),
+		Action:      routing.PlayerKick,
+		Username:    username,
+		Reason:      reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	remaining := gl.playerNames()
+	switch {
+	case started && len(remaining) == 0:
+		return gl.end("", "every player was kicked")
+	case started && len(remaining) == 1:
+		return gl.end(remaining[0], "every opponent was kicked")
+	default:
+		return gl.broadcast()
+	}
+}
+
+// expect makes the room a matched game: only players get in, the game
+// starts once they all registered, and whoever doesn't act for idleTimeout
+// forfeits. An idleTimeout of 0 lets players idle.
+func (gl *gameLifecycle) expect(players []string, idleTimeout time.Duration) {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	for _, username := range players {
+		gl.matched[username] = true
+	}
+	gl.matchedAt = time.Now()
+	gl.idleTimeout = idleTimeout
+}
+
+func (gl *gameLifecycle) register(username string) error {
+	gl.mu.Lock()
+	if gl.forfeited[username] || (len(gl.matched) > 0 && !gl.matched[username]) {
+		gl.mu.Unlock()
+		fmt.Printf("%s isn't playing in %s\n", username, gl.gameID)
+		return nil
+	}
+	if _, ok := gl.players[username]; !ok {
+		gl.players[username] = gamelogic.Player{Username: username, Units: map[int]gamelogic.Unit{}}
+	}
+	ready := len(gl.matched) > 0 && gl.phase == routing.GamePhaseLobby && len(gl.players) == len(gl.matched)
+	gl.mu.Unlock()
+
+	if ready {
+		fmt.Printf("Every matched player joined %s, starting the game\n", gl.gameID)
+		return gl.start(gamelogic.VictoryConditions{TimeLimit: matchTimeLimit})
+	}
+	return gl.broadcast()
+}
+
+func (gl *gameLifecycle) isPlaying(username string) bool {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	_, ok := gl.players[username]
+	return ok && !gl.forfeited[username]
+}
+
+// updateStatus only counts towards the player's stats and keeps them from
+// idling. A status is whatever the player says, so the standings come from
+// the board instead, see applyMove.
+func (gl *gameLifecycle) updateStatus(player gamelogic.Player) {
+	gl.mu.Lock()
+	// only players the lobby let in have a status, see register
+	_, ok := gl.players[player.Username]
+	if !ok || gl.forfeited[player.Username] {
+		gl.mu.Unlock()
+		return
+	}
+	previous := gl.reported[player.Username]
+	gl.reported[player.Username] = player
+	gl.lastActive[player.Username] = time.Now()
+	gl.mu.Unlock()
+
+	err := gl.stats.recordStatus(previous, player)
+	if err != nil {
+		fmt.Printf("couldn't record %s's stats: %v\n", player.Username, err)
+	}
+}
+
+// applyMove puts the units a move showed on the room's board. A move shows
+// all of the player's units where they moved to, and units only get on the
+// board by moving, so units nobody has seen don't count for anything.
+func (gl *gameLifecycle) applyMove(am gamelogic.ArmyMove) {
+	gl.mu.Lock()
+	player, ok := gl.players[am.Player.Username]
+	if !ok || gl.forfeited[am.Player.Username] || gl.phase != routing.GamePhaseStarted {
+		gl.mu.Unlock()
+		return
+	}
+	gl.players[player.Username] = placeUnits(player, am.ToLocation, am.Player.Units)
+	gl.lastActive[player.Username] = time.Now()
+	if len(gl.players[player.Username].Units) > 0 {
+		gl.fielded[player.Username] = true
+	}
+	gl.mu.Unlock()
+
+	gl.checkVictory()
+}
+
+// applyWar fights a war both sides confirmed on the room's board, the way
+// they fought it.
+func (gl *gameLifecycle) applyWar(rw gamelogic.RecognitionOfWar) {
+	resolver, err := gamelogic.NewCombatResolver(gl.combat)
+	if err != nil {
+		fmt.Printf("couldn't fight %s's war on the board: %v\n", gl.gameID, err)
+		return
+	}
+	attackerLeft, defenderLeft := rw.Resolve(resolver)
+	location := rw.Location()
+
+	gl.mu.Lock()
+	if gl.phase != routing.GamePhaseStarted {
+		gl.mu.Unlock()
+		return
+	}
+	for username, left := range map[string][]gamelogic.Unit{rw.Attacker.Username: attackerLeft, rw.Defender.Username: defenderLeft} {
+		player, ok := gl.players[username]
+		if !ok {
+			continue
+		}
+		units := map[int]gamelogic.Unit{}
+		for _, unit := range left {
+			units[unit.ID] = unit
+		}
+		gl.players[username] = placeUnits(player, location, units)
+		if len(units) > 0 {
+			gl.fielded[username] = true
+		}
+	}
+	gl.mu.Unlock()
+
+	gl.checkVictory()
+}
+
+// placeUnits replaces the player's units in location with the units there
+// in units, wherever the board had them before.
+func placeUnits(player gamelogic.Player, location gamelogic.Location, units map[int]gamelogic.Unit) gamelogic.Player {
+	placed := map[int]gamelogic.Unit{}
+	for id, unit := range player.Units {
+		if unit.Location != location {
+			placed[id] = unit
+		}
+	}
+	for id, unit := range units {
+		if unit.Location == location {
+			placed[id] = unit
+		}
+	}
+	return gamelogic.Player{Username: player.Username, Units: placed}
+}
+
+func (gl *gameLifecycle) start(conditions gamelogic.VictoryConditions) error {
+	gl.mu.Lock()
+	if gl.phase == routing.GamePhaseStarted {
+		gl.mu.Unlock()
+		return errors.New("the game has already started")
+	}
+	if len(gl.players) == 0 {
+		gl.mu.Unlock()
+		return errors.New("no players have registered")
+	}
+
+	gl.phase = routing.GamePhaseStarted
+	gl.conditions = conditions
+	gl.startedAt = time.Now()
+	gl.fielded = map[string]bool{}
+	gl.reported = map[string]gamelogic.Player{}
+	for username := range gl.players {
+		gl.players[username] = gamelogic.Player{Username: username, Units: map[int]gamelogic.Unit{}}
+		gl.lastActive[username] = gl.startedAt
+	}
+	gl.mu.Unlock()
+
+	return gl.broadcast()
+}
+
+// checkIdle removes the players who went quiet for longer than the idle
+// timeout, acting being anything that changes their units. Players the
+// server paused are left alone. The last one left wins. Before the game
+// starts it's the matched players who never showed up, and the others
+// start without them.
+func (gl *gameLifecycle) checkIdle() {
+	gl.mu.Lock()
+	if gl.idleTimeout == 0 {
+		gl.mu.Unlock()
+		return
+	}
+
+	idle := []string{}
+	phase := gl.phase
+	switch phase {
+	case routing.GamePhaseLobby:
+		if time.Since(gl.matchedAt) <= gl.idleTimeout {
+			break
+		}
+		for username := range gl.matched {
+			if _, ok := gl.players[username]; !ok && !gl.forfeited[username] {
+				idle = append(idle, username)
+				gl.forfeited[username] = true
+			}
+		}
+	case routing.GamePhaseStarted:
+		for username := range gl.players {
+			if !gl.held[username] && time.Since(gl.lastActive[username]) > gl.idleTimeout {
+				idle = append(idle, username)
+				delete(gl.players, username)
+				delete(gl.fielded, username)
+				gl.forfeited[username] = true
+			}
+		}
+	}
+	gl.mu.Unlock()
+
+	if len(idle) == 0 {
+		return
+	}
+	gl.timeOut(idle, fmt.Sprintf("no moves for %v", gl.idleTimeout))
+
+	remaining := gl.playerNames()
+	var err error
+	switch {
+	case phase == routing.GamePhaseLobby && len(remaining) >= 2:
+		err = gl.start(gamelogic.VictoryConditions{TimeLimit: matchTimeLimit})
+	case phase == routing.GamePhaseLobby:
+		// nobody left to play against
+		gl.mu.Lock()
+		gl.setOver()
+		gl.mu.Unlock()
+		gl.timeOut(remaining, "not enough players showed up")
+		err = gl.broadcast()
+	case len(remaining) == 0:
+		err = gl.end("", "every player timed out")
+	case len(remaining) == 1:
+		err = gl.end(remaining[0], "every opponent timed out")
+	default:
+		err = gl.broadcast()
+	}
+	if err != nil {
+		fmt.Printf("couldn't update %s after timeouts: %v\n", gl.gameID, err)
+	}
+}
+
+// timeOut logs that the players are out of the game and tells them over
+// their matchmaking queues.
+func (gl *gameLifecycle) timeOut(usernames []string, reason string) {
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		fmt.Printf("%s timed out of %s: %s\n", username, gl.gameID, reason)
+		err := gl.logs.Write(routing.GameLog{
+			CurrentTime: time.Now(),
+			Message:     fmt.Sprintf("%s timed out of game %s: %s", username, gl.gameID, reason),
+			Username:    username,
+			Event:       routing.LogEventLifecycle,
+			GameID:      gl.gameID,
+			Outcome:     "timed out",
+		})
+		if err != nil {
+			fmt.Printf("couldn't log %s's timeout: %v\n", username, err)
+		}
+
+		err = publishMatchUpdate(gl.channel, gl.signer, gl.issuer.Inbox(username), routing.MatchUpdate{
+			CurrentTime: time.Now(),
+			State:       routing.MatchTimedOut,
+			GameID:      gl.gameID,
+			Reason:      reason,
+		})
+		if err != nil {
+			fmt.Printf("couldn't tell %s about the timeout: %v\n", username, err)
+		}
+	}
+}
+
+func (gl *gameLifecycle) checkVictory() {
+	gl.mu.Lock()
+	if gl.phase != routing.GamePhaseStarted {
+		gl.mu.Unlock()
+		return
+	}
+	winner, reason, over := gamelogic.CheckVictory(gl.conditions, gl.players, gl.fielded, time.Since(gl.startedAt))
+	gl.mu.Unlock()
+
+	if over {
+		err := gl.end(winner, reason)
+		if err != nil {
+			fmt.Printf("couldn't end the game: %v\n", err)
+		}
+	}
+}
+
+func (gl *gameLifecycle) end(winner, reason string) error {
+	gl.mu.Lock()
+	if gl.phase != routing.GamePhaseStarted {
+		gl.mu.Unlock()
+		return errors.New("the game is not running")
+	}
+	gl.setOver()
+	standings := gamelogic.GetStandings(gl.players)
+	gl.mu.Unlock()
+
+	fmt.Println()
+	fmt.Printf("==== Game Over in %s ====\n", gl.gameID)
+	gamelogic.PrintStandings(standings)
+
+	err := gl.stats.recordGameOver(standings, winner)
+	if err != nil {
+		fmt.Printf("couldn't record the game's stats: %v\n", err)
+	}
+
+	message := fmt.Sprintf("game %s over, nobody won: %s", gl.gameID, reason)
+	if winner != "" {
+		message = fmt.Sprintf("game %s over, %s won: %s", gl.gameID, winner, reason)
+	}
+	err = gl.logs.Write(routing.GameLog{
+		CurrentTime:  time.Now(),
+		Message:      message,
+		Username:     winner,
+		Event:        routing.LogEventLifecycle,
+		GameID:       gl.gameID,
+		Participants: gl.playerNames(),
+		Outcome:      reason,
+	})
+	if err != nil {
+		return err
+	}
+	for i, standing := range standings {
+		err := gl.logs.Write(routing.GameLog{
+			CurrentTime: time.Now(),
+			Message: fmt.Sprintf(
+				"finished #%v with score %v, %v territories and %v units",
+				i+1,
+				standing.Score,
+				standing.Territories,
+				standing.Units,
+			),
+			Username: standing.Username,
+			Event:    routing.LogEventLifecycle,
+			GameID:   gl.gameID,
+			Outcome:  fmt.Sprintf("#%v", i+1),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return gl.publish(routing.GameLifecycle{
+		CurrentTime: time.Now(),
+		Phase:       routing.GamePhaseOver,
+		Players:     gl.playerNames(),
+		Winner:      winner,
+		Reason:      reason,
+		Standings:   standings,
+	})
+}
+
+func (gl *gameLifecycle) standings() []routing.Standing {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	return gamelogic.GetStandings(gl.players)
+}
+
+func (gl *gameLifecycle) playerNames() []string {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	names := []string{}
+	for username := range gl.players {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (gl *gameLifecycle) broadcast() error {
+	gl.mu.Lock()
+	lifecycle := routing.GameLifecycle{
+		CurrentTime: time.Now(),
+		Phase:       gl.phase,
+		Territories: gl.conditions.Territories,
+		TimeLimit:   gl.conditions.TimeLimit,
+	}
+	if gl.phase == routing.GamePhaseOver {
+		lifecycle.Standings = gamelogic.GetStandings(gl.players)
+	}
+	gl.mu.Unlock()
+
+	lifecycle.Players = gl.playerNames()
+	return gl.publish(lifecycle)
+}
+
+func (gl *gameLifecycle) publish(lifecycle routing.GameLifecycle) error {
+	lifecycle.Combat = gl.combat
+	return pubsub.PublishJSON(
+		gl.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(gl.gameID, routing.GameLifecycleKey),
+		lifecycle,
+		pubsub.WithSignature(gl.signer),
+	)
+}
+
+func (gl *gameLifecycle) publishControl(pc routing.PlayerControl) error {
+	return pubsub.PublishJSON(
+		gl.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(gl.gameID, routing.PlayerControlPrefix, pc.Username),
+		pc,
+		pubsub.WithSignature(gl.signer),
+	)
+}
+
+func lobbyHandler(r *room) func(routing.LobbyRegistration) pubsub.AckType {
+	return func(registration routing.LobbyRegistration) pubsub.AckType {
+		defer fmt.Printf("> ")
+		fmt.Printf("%s joined the game %s\n", registration.Username, r.gameID)
+
+		err := r.lifecycle.register(registration.Username)
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		if !r.lifecycle.isPlaying(registration.Username) {
+			return pubsub.Ack
+		}
+
+		err = r.join(registration.Username)
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+func moveHandler(gl *gameLifecycle) func(gamelogic.ArmyMove) pubsub.AckType {
+	return func(am gamelogic.ArmyMove) pubsub.AckType {
+		gl.applyMove(am)
+		return pubsub.Ack
+	}
+}
+
+func playerStatusHandler(gl *gameLifecycle) func(gamelogic.Player) pubsub.AckType {
+	return func(player gamelogic.Player) pubsub.AckType {
+		gl.updateStatus(player)
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// parseLogFilter reads key=value filters. Times are either RFC3339 or a
+// duration meaning that long ago.
+func parseLogFilter(words []string) (gamelogic.LogFilter, error) {
+	filter := gamelogic.LogFilter{}
+	for _, word := range words {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok || value == "" {
+			return filter, fmt.Errorf("%s is not a key=value filter", word)
+		}
+
+		switch key {
+		case "player":
+			filter.Username = value
+		case "event":
+			filter.Event = routing.LogEvent(value)
+		case "game":
+			filter.GameID = value
+		case "since", "until":
+			t, err := parseLogTime(value)
+			if err != nil {
+				return filter, err
+			}
+			if key == "since" {
+				filter.Since = t
+			} else {
+				filter.Until = t
+			}
+		default:
+			return filter, fmt.Errorf("unknown filter: %s", key)
+		}
+	}
+	return filter, nil
+}
+
+func parseLogTime(value string) (time.Time, error) {
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither a duration nor an RFC3339 time", value)
+	}
+	return t, nil
+}
+
+func queryLogs(svc *service, words []string) error {
+	filter, err := parseLogFilter(words)
+	if err != nil {
+		return err
+	}
+
+	logs, err := svc.queryLogs(filter)
+	if err != nil {
+		return err
+	}
+	gamelogic.PrintLogs(logs)
+	return nil
+}
+
+func exportLogs(svc *service, format, path string, words []string) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+
+	filter, err := parseLogFilter(words)
+	if err != nil {
+		return err
+	}
+
+	logs, err := svc.queryLogs(filter)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = gamelogic.ExportLogs(f, logs, format)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %v logs to %s\n", len(logs), path)
+	return nil
+}
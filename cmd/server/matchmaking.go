@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minMatchSize  = 2
+	maxMatchSize  = 8
+	matchInterval = time.Second
+	// how long a matched room stays after its game is over
+	matchCloseDelay = 30 * time.Second
+)
+
+// Players are matched with others whose skill is within matchSkillGap of
+// the one who waited longest. The gap widens by matchSkillGapGrowth every
+// matchSkillGapEvery that player keeps waiting, so nobody waits forever.
+const (
+	matchSkillGap       = 0.15
+	matchSkillGapGrowth = 0.1
+	matchSkillGapEvery  = 30 * time.Second
+)
+
+type queuedPlayer struct {
+	Username string
+	Size     int
+	Skill    float64
+	QueuedAt time.Time
+}
+
+// matchmaker groups the players asking for a game by the number of players
+// they want and by skill, then makes a room for each group.
+type matchmaker struct {
+	channel     *amqp.Channel
+	rooms       *roomManager
+	stats       *statsTracker
+	idleTimeout time.Duration
+	queue       []queuedPlayer
+	mu          *sync.Mutex
+}
+
+func newMatchmaker(channel *amqp.Channel, rooms *roomManager, stats *statsTracker, idleTimeout time.Duration) *matchmaker {
+	mm := &matchmaker{
+		channel:     channel,
+		rooms:       rooms,
+		stats:       stats,
+		idleTimeout: idleTimeout,
+		queue:       []queuedPlayer{},
+		mu:          &sync.Mutex{},
+	}
+
+	// skill gaps widen with time, so waiting players are looked at again
+	// even when nobody new comes in
+	go func() {
+		ticker := time.NewTicker(matchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			mm.match()
+		}
+	}()
+
+	return mm
+}
+
+func (mm *matchmaker) enqueue(req routing.MatchRequest) error {
+	if req.Size < minMatchSize || req.Size > maxMatchSize {
+		return publishMatchUpdate(mm.channel, mm.rooms.signer, mm.rooms.issuer.Inbox(req.Username), routing.MatchUpdate{
+			CurrentTime: time.Now(),
+			State:       routing.MatchCancelled,
+			Size:        req.Size,
+			Reason:      fmt.Sprintf("games have %v to %v players", minMatchSize, maxMatchSize),
+		})
+	}
+
+	mm.mu.Lock()
+	mm.remove(req.Username)
+	mm.queue = append(mm.queue, queuedPlayer{
+		Username: req.Username,
+		Size:     req.Size,
+		Skill:    mm.stats.skill(req.Username),
+		QueuedAt: time.Now(),
+	})
+	waiting := 0
+	for _, queued := range mm.queue {
+		if queued.Size == req.Size {
+			waiting++
+		}
+	}
+	mm.mu.Unlock()
+
+	fmt.Printf("%s is looking for a %v-player game\n", req.Username, req.Size)
+	err := publishMatchUpdate(mm.channel, mm.rooms.signer, mm.rooms.issuer.Inbox(req.Username), routing.MatchUpdate{
+		CurrentTime: time.Now(),
+		State:       routing.MatchQueued,
+		Size:        req.Size,
+		Reason:      fmt.Sprintf("%v of %v players waiting", waiting, req.Size),
+	})
+	if err != nil {
+		return err
+	}
+
+	mm.match()
+	return nil
+}
+
+func (mm *matchmaker) cancel(username string) error {
+	mm.mu.Lock()
+	removed := mm.remove(username)
+	mm.mu.Unlock()
+
+	if !removed {
+		return nil
+	}
+	fmt.Printf("%s stopped looking for a game\n", username)
+	return publishMatchUpdate(mm.channel, mm.rooms.signer, mm.rooms.issuer.Inbox(username), routing.MatchUpdate{
+		CurrentTime: time.Now(),
+		State:       routing.MatchCancelled,
+		Reason:      "you left the queue",
+	})
+}
+
+// remove must be called with the lock held.
+func (mm *matchmaker) remove(username string) bool {
+	for i, queued := range mm.queue {
+		if queued.Username == username {
+			mm.queue = append(mm.queue[:i], mm.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (mm *matchmaker) waiting() []queuedPlayer {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	waiting := make([]queuedPlayer, len(mm.queue))
+	copy(waiting, mm.queue)
+	return waiting
+}
+
+// match starts every game it can, the longest waiting players first.
+func (mm *matchmaker) match() {
+	mm.mu.Lock()
+	groups := [][]queuedPlayer{}
+	for {
+		group := mm.nextGroup()
+		if group == nil {
+			break
+		}
+		groups = append(groups, group)
+	}
+	mm.mu.Unlock()
+
+	for _, group := range groups {
+		err := mm.startMatch(group)
+		if err != nil {
+			fmt.Printf("couldn't start a match: %v\n", err)
+		}
+	}
+}
+
+// nextGroup takes a full group out of the queue, or returns nil when there
+// is none. It must be called with the lock held.
+func (mm *matchmaker) nextGroup() []queuedPlayer {
+	for _, anchor := range mm.queue {
+		others := []queuedPlayer{}
+		for _, queued := range mm.queue {
+			if queued.Size == anchor.Size && queued.Username != anchor.Username {
+				others = append(others, queued)
+			}
+		}
+		if len(others) < anchor.Size-1 {
+			continue
+		}
+
+		// the closest in skill, and among equals the ones waiting longest
+		sort.SliceStable(others, func(i, j int) bool {
+			return math.Abs(others[i].Skill-anchor.Skill) < math.Abs(others[j].Skill-anchor.Skill)
+		})
+		group := append([]queuedPlayer{anchor}, others[:anchor.Size-1]...)
+
+		widened := float64(time.Since(anchor.QueuedAt) / matchSkillGapEvery)
+		if math.Abs(group[len(group)-1].Skill-anchor.Skill) > matchSkillGap+widened*matchSkillGapGrowth {
+			continue
+		}
+
+		for _, queued := range group {
+			mm.remove(queued.Username)
+		}
+		return group
+	}
+	return nil
+}
+
+func (mm *matchmaker) startMatch(group []queuedPlayer) error {
+	players := []string{}
+	for _, queued := range group {
+		players = append(players, queued.Username)
+	}
+	sort.Strings(players)
+
+	gameID := "match-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	r, err := mm.rooms.create(gameID)
+	if err != nil {
+		for _, username := range players {
+			publishMatchUpdate(mm.channel, mm.rooms.signer, mm.rooms.issuer.Inbox(username), routing.MatchUpdate{
+				CurrentTime: time.Now(),
+				State:       routing.MatchCancelled,
+				Size:        len(players),
+				Reason:      "the server couldn't make a room, please try again",
+			})
+		}
+		return err
+	}
+	r.lifecycle.expect(players, mm.idleTimeout)
+	go mm.closeWhenOver(r)
+
+	fmt.Printf("Matched %s in %s\n", strings.Join(players, ", "), gameID)
+	for _, username := range players {
+		err := publishMatchUpdate(mm.channel, mm.rooms.signer, mm.rooms.issuer.Inbox(username), routing.MatchUpdate{
+			CurrentTime: time.Now(),
+			State:       routing.MatchFound,
+			Size:        len(players),
+			GameID:      gameID,
+			Players:     players,
+		})
+		if err != nil {
+			fmt.Printf("couldn't tell %s about their match: %v\n", username, err)
+		}
+	}
+	return nil
+}
+
+// closeWhenOver closes a matched room once its game is over, or everyone
+// forfeited it, so nobody plays in it again. The wait lets the last logs
+// and wars of the game come in first.
+func (mm *matchmaker) closeWhenOver(r *room) {
+	<-r.lifecycle.done()
+	time.Sleep(matchCloseDelay)
+
+	current, ok := mm.rooms.get(r.gameID)
+	if !ok || current != r {
+		return
+	}
+	err := mm.rooms.close(r.gameID)
+	if err != nil {
+		fmt.Printf("couldn't close %s: %v\n", r.gameID, err)
+		return
+	}
+	fmt.Printf("Closed %s, its game is over\n", r.gameID)
+}
+
+// publishMatchUpdate goes under the player's inbox, so nobody else can
+// listen in or tell them about a match of their own making.
+func publishMatchUpdate(channel *amqp.Channel, signer pubsub.Signer, inbox string, update routing.MatchUpdate) error {
+	return pubsub.PublishJSON(
+		channel,
+		routing.ExchangePerilDirect,
+		routing.MatchUpdatePrefix+"."+inbox,
+		update,
+		pubsub.WithSignature(signer),
+	)
+}
+
+func matchRequestHandler(mm *matchmaker) func(routing.MatchRequest) pubsub.AckType {
+	return func(req routing.MatchRequest) pubsub.AckType {
+		defer fmt.Printf("> ")
+
+		var err error
+		if req.Cancel {
+			err = mm.cancel(req.Username)
+		} else {
+			err = mm.enqueue(req)
+		}
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
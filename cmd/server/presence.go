@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// presenceTracker keeps a room's online roster from the players'
+// heartbeats, and tells everyone in the room when somebody comes or goes.
+type presenceTracker struct {
+	gameID   string
+	channel  *amqp.Channel
+	signer   pubsub.Signer
+	lastSeen map[string]time.Time
+	closed   bool
+	mu       *sync.Mutex
+}
+
+func newPresenceTracker(gameID string, channel *amqp.Channel, signer pubsub.Signer) *presenceTracker {
+	pt := &presenceTracker{
+		gameID:   gameID,
+		channel:  channel,
+		signer:   signer,
+		lastSeen: map[string]time.Time{},
+		mu:       &sync.Mutex{},
+	}
+
+	go func() {
+		ticker := time.NewTicker(routing.HeartbeatInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if pt.isClosed() {
+				return
+			}
+			pt.expire()
+		}
+	}()
+
+	return pt
+}
+
+func (pt *presenceTracker) close() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.closed = true
+}
+
+func (pt *presenceTracker) isClosed() bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.closed
+}
+
+func (pt *presenceTracker) heartbeat(hb routing.Heartbeat) error {
+	pt.mu.Lock()
+	_, online := pt.lastSeen[hb.Username]
+	if hb.Leaving {
+		delete(pt.lastSeen, hb.Username)
+	} else {
+		pt.lastSeen[hb.Username] = time.Now()
+	}
+	pt.mu.Unlock()
+
+	switch {
+	case hb.Leaving && online:
+		return pt.publish(routing.PresenceLeave, hb.Username)
+	case !hb.Leaving && !online:
+		return pt.publish(routing.PresenceJoin, hb.Username)
+	}
+	return nil
+}
+
+// expire takes the players whose heartbeats stopped off the roster.
+func (pt *presenceTracker) expire() {
+	pt.mu.Lock()
+	gone := []string{}
+	for username, seen := range pt.lastSeen {
+		if time.Since(seen) > routing.HeartbeatTimeout {
+			gone = append(gone, username)
+			delete(pt.lastSeen, username)
+		}
+	}
+	pt.mu.Unlock()
+
+	sort.Strings(gone)
+	for _, username := range gone {
+		err := pt.publish(routing.PresenceTimeout, username)
+		if err != nil {
+			fmt.Printf("couldn't announce %s's timeout: %v\n", username, err)
+		}
+	}
+}
+
+func (pt *presenceTracker) online() []string {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	names := []string{}
+	for username := range pt.lastSeen {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (pt *presenceTracker) publish(kind routing.PresenceKind, username string) error {
+	return pubsub.PublishJSON(
+		pt.channel,
+		routing.ExchangePerilDirect,
+		routing.GameKey(pt.gameID, routing.PresenceEventsKey),
+		routing.PresenceEvent{
+			CurrentTime: time.Now(),
+			Kind:        kind,
+			Username:    username,
+			Online:      pt.online(),
+		},
+		pubsub.WithSignature(pt.signer),
+	)
+}
+
+func heartbeatHandler(pt *presenceTracker) func(routing.Heartbeat) pubsub.AckType {
+	return func(hb routing.Heartbeat) pubsub.AckType {
+		err := pt.heartbeat(hb)
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logsink"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultGameID = "main"
+
+// game logs are committed in groups of up to logBatchSize, waiting at most
+// logBatchWait for a group to fill up
+const (
+	logBatchSize = 100
+	logBatchWait = 50 * time.Millisecond
+)
+
+var validGameID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type room struct {
+	gameID    string
+	channel   *amqp.Channel
+	issuer    *auth.TokenIssuer
+	lifecycle *gameLifecycle
+	moderator *chatModerator
+	presence  *presenceTracker
+	wars      *warLedger
+	queues    []string
+}
+
+type roomManager struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	keys    pubsub.KeyRegistry
+	signer  pubsub.Signer
+	issuer  *auth.TokenIssuer
+	logs    logsink.LogSink
+	stats   *statsTracker
+	combat  string
+	// competing consumers of every room's game logs
+	logConsumers int
+	rooms        map[string]*room
+	mu           *sync.Mutex
+}
+
+func newRoomManager(conn *amqp.Connection, channel *amqp.Channel, keys pubsub.KeyRegistry, signer pubsub.Signer, issuer *auth.TokenIssuer, logs logsink.LogSink, stats *statsTracker, combat string, logConsumers int) *roomManager {
+	return &roomManager{
+		conn:         conn,
+		channel:      channel,
+		keys:         keys,
+		signer:       signer,
+		issuer:       issuer,
+		logs:         logs,
+		stats:        stats,
+		combat:       combat,
+		logConsumers: logConsumers,
+		rooms:        map[string]*room{},
+		mu:           &sync.Mutex{},
+	}
+}
+
+func (rm *roomManager) create(gameID string) (*room, error) {
+	if !validGameID.MatchString(gameID) {
+		return nil, fmt.Errorf("%s is not a valid game ID, use letters, digits, - and _", gameID)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if _, ok := rm.rooms[gameID]; ok {
+		return nil, fmt.Errorf("room %s already exists", gameID)
+	}
+
+	r := &room{
+		gameID:    gameID,
+		channel:   rm.channel,
+		issuer:    rm.issuer,
+		lifecycle: newGameLifecycle(gameID, rm.combat, rm.channel, rm.signer, rm.issuer, rm.logs, rm.stats),
+		moderator: newChatModerator(gameID, rm.channel, rm.signer, rm.issuer),
+		presence:  newPresenceTracker(gameID, rm.channel, rm.signer),
+		wars:      newWarLedger(),
+	}
+
+	err := r.subscribe(rm.conn, rm.keys, rm.logs, rm.stats, rm.logConsumers)
+	if err != nil {
+		return nil, err
+	}
+
+	rm.rooms[gameID] = r
+	return r, nil
+}
+
+func (rm *roomManager) get(gameID string) (*room, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	r, ok := rm.rooms[gameID]
+	return r, ok
+}
+
+func (rm *roomManager) close(gameID string) error {
+	rm.mu.Lock()
+	r, ok := rm.rooms[gameID]
+	delete(rm.rooms, gameID)
+	rm.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("room %s does not exist", gameID)
+	}
+
+	r.presence.close()
+	err := r.lifecycle.close()
+	if err != nil {
+		return err
+	}
+
+	// deleting the queues cancels their consumers, which ends the
+	// subscription goroutines
+	errs := []error{}
+	for _, queue := range r.queues {
+		_, err := rm.channel.QueueDelete(queue, false, false, false)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (rm *roomManager) list() []routing.RoomInfo {
+	rm.mu.Lock()
+	rooms := []*room{}
+	for _, r := range rm.rooms {
+		rooms = append(rooms, r)
+	}
+	rm.mu.Unlock()
+
+	infos := []routing.RoomInfo{}
+	for _, r := range rooms {
+		infos = append(infos, r.lifecycle.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].GameID < infos[j].GameID })
+	return infos
+}
+
+func (r *room) subscribe(conn *amqp.Connection, keys pubsub.KeyRegistry, logs logsink.LogSink, stats *statsTracker, logConsumers int) error {
+	// the consumers share the war ledger, so both sides of a war still
+	// meet whichever consumer gets them
+	var err error
+	logQueue := routing.GameKey(r.gameID, routing.GameLogSlug)
+	for i := 0; i < logConsumers; i++ {
+		err = pubsub.SubscribeGOBBatch(
+			conn,
+			routing.ExchangePerilTopic,
+			logQueue,
+			routing.GameKey(r.gameID, routing.GameLogSlug, "*"),
+			1,
+			logBatchSize,
+			logBatchWait,
+			logHandler(r.gameID, logs, stats, r.wars, r.lifecycle),
+			pubsub.RequireSignature(keys, func(gl routing.GameLog) string { return gl.Username }),
+		)
+		if err != nil {
+			return fmt.Errorf("couldn't subsribe to game logs: %v", err)
+		}
+	}
+	r.queues = append(r.queues, logQueue)
+
+	// the board the standings come from is what the moves showed and the
+	// confirmed wars left of it
+	moveQueue := routing.GameKey(r.gameID, routing.ArmyMovesPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		moveQueue,
+		routing.GameKey(r.gameID, routing.ArmyMovesPrefix, "*"),
+		1,
+		moveHandler(r.lifecycle),
+		pubsub.RequireSignature(keys, func(am gamelogic.ArmyMove) string { return am.Player.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to moves: %v", err)
+	}
+	r.queues = append(r.queues, moveQueue)
+
+	warQueue := routing.GameKey(r.gameID, routing.WarRecognitionsPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		warQueue,
+		routing.GameKey(r.gameID, routing.WarRecognitionsPrefix, "*"),
+		1,
+		warHandler(r),
+		pubsub.RequireSignature(keys, func(rw gamelogic.RecognitionOfWar) string { return rw.Defender.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to wars: %v", err)
+	}
+	r.queues = append(r.queues, warQueue)
+
+	diplomacyQueue := routing.GameKey(r.gameID, routing.DiplomacyPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		diplomacyQueue,
+		routing.GameKey(r.gameID, routing.DiplomacyPrefix, "*"),
+		1,
+		diplomacyHandler(r.gameID, logs, r.moderator.treaties),
+		pubsub.RequireSignature(keys, func(d gamelogic.Diplomacy) string { return d.From }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to diplomacy: %v", err)
+	}
+	r.queues = append(r.queues, diplomacyQueue)
+
+	lobbyQueue := routing.GameKey(r.gameID, routing.LobbyPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		lobbyQueue,
+		routing.GameKey(r.gameID, routing.LobbyPrefix, "*"),
+		1,
+		lobbyHandler(r),
+		pubsub.RequireSignature(keys, func(lr routing.LobbyRegistration) string { return lr.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to lobby: %v", err)
+	}
+	r.queues = append(r.queues, lobbyQueue)
+
+	// a status shows every unit of the player, so like chat it only comes
+	// in under the players' inboxes, see join
+	statusQueue := routing.GameKey(r.gameID, routing.PlayerStatusPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		statusQueue,
+		statusQueue,
+		1,
+		playerStatusHandler(r.lifecycle),
+		pubsub.RequireSignature(keys, func(p gamelogic.Player) string { return p.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to player status: %v", err)
+	}
+	r.queues = append(r.queues, statusQueue)
+
+	chatQueue := routing.GameKey(r.gameID, routing.ChatSendPrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		chatQueue,
+		chatQueue,
+		1,
+		chatHandler(r.moderator),
+		pubsub.RequireSignature(keys, func(msg routing.ChatMessage) string { return msg.From }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to chat: %v", err)
+	}
+	r.queues = append(r.queues, chatQueue)
+
+	presenceQueue := routing.GameKey(r.gameID, routing.PresencePrefix)
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		presenceQueue,
+		routing.GameKey(r.gameID, routing.PresencePrefix, "*"),
+		1,
+		heartbeatHandler(r.presence),
+		pubsub.RequireSignature(keys, func(hb routing.Heartbeat) string { return hb.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subsribe to presence: %v", err)
+	}
+	r.queues = append(r.queues, presenceQueue)
+
+	return nil
+}
+
+// join binds the keys under the player's inbox to the room's queues, so
+// they can send their status and chat, and replays the chat to them.
+func (r *room) join(username string) error {
+	inbox := r.issuer.Inbox(username)
+	for _, prefix := range []string{routing.PlayerStatusPrefix, routing.ChatSendPrefix} {
+		err := r.channel.QueueBind(
+			routing.GameKey(r.gameID, prefix),
+			routing.GameKey(r.gameID, prefix, inbox),
+			routing.ExchangePerilDirect,
+			false,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return r.moderator.replay(username)
+}
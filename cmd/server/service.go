@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	errUnknownRoom = errors.New("room does not exist")
+	errNoLogsFile  = errors.New("no file log sink to read from, start the server with -logs file:<path>")
+	errNoMessage   = errors.New("the announcement is empty")
+)
+
+// service is everything the server can be told to do. The REPL and the
+// admin api are both thin layers over it.
+type service struct {
+	conn     *amqp.Connection
+	rooms    *roomManager
+	stats    *statsTracker
+	matches  *matchmaker
+	logsPath string
+}
+
+type health struct {
+	Broker bool
+	Rooms  int
+}
+
+func (s *service) health() health {
+	return health{Broker: s.conn != nil && !s.conn.IsClosed(), Rooms: len(s.rooms.list())}
+}
+
+func (s *service) listRooms() []routing.RoomInfo {
+	return s.rooms.list()
+}
+
+func (s *service) createRoom(gameID string) error {
+	_, err := s.rooms.create(gameID)
+	return err
+}
+
+func (s *service) closeRoom(gameID string) error {
+	if _, err := s.room(gameID); err != nil {
+		return err
+	}
+	return s.rooms.close(gameID)
+}
+
+func (s *service) room(gameID string) (*room, error) {
+	r, ok := s.rooms.get(gameID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownRoom, gameID)
+	}
+	return r, nil
+}
+
+func (s *service) roomState(gameID string) (roomState, error) {
+	r, err := s.room(gameID)
+	if err != nil {
+		return roomState{}, err
+	}
+	state := r.lifecycle.state()
+	state.Online = r.presence.online()
+	return state, nil
+}
+
+func (s *service) online(gameID string) ([]string, error) {
+	r, err := s.room(gameID)
+	if err != nil {
+		return nil, err
+	}
+	return r.presence.online(), nil
+}
+
+func (s *service) standings(gameID string) ([]routing.Standing, error) {
+	r, err := s.room(gameID)
+	if err != nil {
+		return nil, err
+	}
+	return r.lifecycle.standings(), nil
+}
+
+func (s *service) setPaused(gameID string, paused bool) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+	return r.lifecycle.setPaused(paused)
+}
+
+func (s *service) setPlayerPaused(gameID, username string, paused bool) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+	return r.lifecycle.setPlayerPaused(username, paused)
+}
+
+// kick takes the player out of both the game and its chat.
+func (s *service) kick(gameID, username string) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+	err = r.lifecycle.kick(username)
+	if err != nil {
+		return err
+	}
+	return r.moderator.kick(username)
+}
+
+// announce sends message to everyone in gameID, or in every room when
+// gameID is empty.
+func (s *service) announce(gameID, message string) error {
+	if message == "" {
+		return errNoMessage
+	}
+	if gameID != "" {
+		if _, err := s.room(gameID); err != nil {
+			return err
+		}
+	}
+	return pubsub.PublishJSON(
+		s.rooms.channel,
+		routing.ExchangePerilDirect,
+		routing.AnnouncementsKey,
+		routing.Announcement{CurrentTime: time.Now(), GameID: gameID, Message: message},
+		pubsub.WithSignature(s.rooms.signer),
+	)
+}
+
+func (s *service) start(gameID string, conditions gamelogic.VictoryConditions) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+	return r.lifecycle.start(conditions)
+}
+
+// end gives the game to the leader, unless the top of the standings is
+// a tie.
+func (s *service) end(gameID string) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+
+	standings := r.lifecycle.standings()
+	winner := ""
+	if len(standings) == 1 || (len(standings) > 1 && standings[0].Score > standings[1].Score) {
+		winner = standings[0].Username
+	}
+	return r.lifecycle.end(winner, "the server ended the game")
+}
+
+func (s *service) moderate(gameID, action, username string) error {
+	r, err := s.room(gameID)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "mute":
+		r.moderator.mute(username)
+	case "unmute":
+		r.moderator.unmute(username)
+	case "kick":
+		return s.kick(gameID, username)
+	case "pause", "resume":
+		return r.lifecycle.setPlayerPaused(username, action == "pause")
+	default:
+		return fmt.Errorf("unknown moderation action: %s", action)
+	}
+	return nil
+}
+
+func (s *service) queryLogs(filter gamelogic.LogFilter) ([]routing.GameLog, error) {
+	if s.logsPath == "" {
+		return nil, errNoLogsFile
+	}
+	return gamelogic.ReadLogs(s.logsPath, filter)
+}
+
+func (s *service) matchQueue() []queuedPlayer {
+	return s.matches.waiting()
+}
+
+func (s *service) leaderboard() []routing.PlayerStats {
+	return s.stats.leaderboard()
+}
+
+func (s *service) playerStats(username string) (routing.PlayerStats, error) {
+	return s.stats.player(username)
+}
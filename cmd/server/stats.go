@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var errNoStats = errors.New("no stats")
+
+const defaultSkill = 0.5
+
+// the stats file is rewritten at most every statsFlushInterval, and at the
+// end of every game
+const statsFlushInterval = 5 * time.Second
+
+// statsTracker adds up every player's results across rooms and games and
+// keeps them in a JSON file.
+type statsTracker struct {
+	path  string
+	stats map[string]*routing.PlayerStats
+	dirty bool
+	mu    *sync.Mutex
+}
+
+func newStatsTracker(path string) (*statsTracker, error) {
+	st := &statsTracker{
+		path:  path,
+		stats: map[string]*routing.PlayerStats{},
+		mu:    &sync.Mutex{},
+	}
+	go func() {
+		for range time.Tick(statsFlushInterval) {
+			err := st.flush()
+			if err != nil {
+				fmt.Printf("couldn't save the stats: %v\n", err)
+			}
+		}
+	}()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read stats file: %v", err)
+	}
+
+	err = json.Unmarshal(data, &st.stats)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse stats file: %v", err)
+	}
+	return st, nil
+}
+
+// recordLogs picks the war outcomes out of the game logs, which only hold
+// wars both sides confirmed.
+func (st *statsTracker) recordLogs(gamelogs []routing.GameLog) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	changed := false
+	for _, gamelog := range gamelogs {
+		if gamelog.Event != routing.LogEventWar || len(gamelog.Participants) != 2 {
+			continue
+		}
+
+		if gamelog.Outcome == "draw" {
+			for _, username := range gamelog.Participants {
+				st.get(username).Draws++
+			}
+			changed = true
+			continue
+		}
+
+		for _, username := range gamelog.Participants {
+			if username == gamelog.Winner {
+				st.get(username).Wins++
+			} else {
+				st.get(username).Losses++
+			}
+		}
+		changed = true
+	}
+
+	st.dirty = st.dirty || changed
+	return nil
+}
+
+// recordStatus compares a player's new status with the last one: units
+// that appeared were spawned, units that vanished were lost in a war.
+func (st *statsTracker) recordStatus(previous, current gamelogic.Player) error {
+	spawned, lost := 0, 0
+	for id := range current.Units {
+		if _, ok := previous.Units[id]; !ok {
+			spawned++
+		}
+	}
+	for id := range previous.Units {
+		if _, ok := current.Units[id]; !ok {
+			lost++
+		}
+	}
+	if spawned == 0 && lost == 0 {
+		return nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	stats := st.get(current.Username)
+	stats.UnitsSpawned += spawned
+	stats.UnitsLost += lost
+	st.dirty = true
+	return nil
+}
+
+func (st *statsTracker) recordGameOver(standings []routing.Standing, winner string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, standing := range standings {
+		stats := st.get(standing.Username)
+		stats.GamesPlayed++
+		stats.Territories += standing.Territories
+		if standing.Username == winner {
+			stats.GamesWon++
+		}
+	}
+	return st.save()
+}
+
+// flush saves the stats if they changed since they were last saved.
+func (st *statsTracker) flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.dirty {
+		return nil
+	}
+	return st.save()
+}
+
+func (st *statsTracker) player(username string) (routing.PlayerStats, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	stats, ok := st.stats[username]
+	if !ok {
+		return routing.PlayerStats{}, fmt.Errorf("%w for %s", errNoStats, username)
+	}
+	return *stats, nil
+}
+
+// skill is the share of games and wars a player won, games counting
+// double, from 0 to 1. Players without any are matched as average.
+func (st *statsTracker) skill(username string) float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	stats, ok := st.stats[username]
+	if !ok {
+		return defaultSkill
+	}
+
+	played := 2*stats.GamesPlayed + stats.Wins + stats.Losses + stats.Draws
+	if played == 0 {
+		return defaultSkill
+	}
+	return float64(2*stats.GamesWon+stats.Wins) / float64(played)
+}
+
+// leaderboard ranks players by games won, then wars won, then the fewest
+// wars lost.
+func (st *statsTracker) leaderboard() []routing.PlayerStats {
+	st.mu.Lock()
+	board := []routing.PlayerStats{}
+	for _, stats := range st.stats {
+		board = append(board, *stats)
+	}
+	st.mu.Unlock()
+
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].GamesWon != board[j].GamesWon {
+			return board[i].GamesWon > board[j].GamesWon
+		}
+		if board[i].Wins != board[j].Wins {
+			return board[i].Wins > board[j].Wins
+		}
+		if board[i].Losses != board[j].Losses {
+			return board[i].Losses < board[j].Losses
+		}
+		return board[i].Username < board[j].Username
+	})
+	return board
+}
+
+func (st *statsTracker) get(username string) *routing.PlayerStats {
+	stats, ok := st.stats[username]
+	if !ok {
+		stats = &routing.PlayerStats{Username: username}
+		st.stats[username] = stats
+	}
+	return stats
+}
+
+// save must be called with the lock held.
+func (st *statsTracker) save() error {
+	data, err := json.MarshalIndent(st.stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := st.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write stats file: %v", err)
+	}
+	err = os.Rename(tmp, st.path)
+	if err != nil {
+		return err
+	}
+	st.dirty = false
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// treatyTracker follows a room's diplomacy the way the players' game states
+// do, so the server knows who to deliver alliance chat to.
+type treatyTracker struct {
+	proposals map[string]map[string]gamelogic.TreatyKind
+	treaties  map[string]map[string]gamelogic.TreatyKind
+	mu        *sync.Mutex
+}
+
+func newTreatyTracker() *treatyTracker {
+	return &treatyTracker{
+		proposals: map[string]map[string]gamelogic.TreatyKind{},
+		treaties:  map[string]map[string]gamelogic.TreatyKind{},
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (tt *treatyTracker) handle(d gamelogic.Diplomacy) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	switch d.Action {
+	case gamelogic.DiplomacyPropose:
+		setTreaty(tt.proposals, d.From, d.To, d.Treaty)
+	case gamelogic.DiplomacyAccept:
+		// an accept only signs what the other side proposed
+		proposed, ok := tt.proposals[d.To][d.From]
+		if !ok || proposed != d.Treaty {
+			return
+		}
+		delete(tt.proposals[d.To], d.From)
+		setTreaty(tt.treaties, d.From, d.To, d.Treaty)
+		setTreaty(tt.treaties, d.To, d.From, d.Treaty)
+	case gamelogic.DiplomacyBreak:
+		delete(tt.treaties[d.From], d.To)
+		delete(tt.treaties[d.To], d.From)
+	}
+}
+
+func (tt *treatyTracker) allies(username string) []string {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	allies := []string{}
+	for other, treaty := range tt.treaties[username] {
+		if treaty == gamelogic.TreatyAlliance {
+			allies = append(allies, other)
+		}
+	}
+	sort.Strings(allies)
+	return allies
+}
+
+func setTreaty(treaties map[string]map[string]gamelogic.TreatyKind, from, to string, treaty gamelogic.TreatyKind) {
+	if treaties[from] == nil {
+		treaties[from] = map[string]gamelogic.TreatyKind{}
+	}
+	treaties[from][to] = treaty
+}
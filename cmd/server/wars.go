@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// a war only one side ever reported is forgotten after warReportTimeout
+const warReportTimeout = 5 * time.Minute
+
+type warReport struct {
+	gamelog  routing.GameLog
+	received time.Time
+}
+
+type recognizedWar struct {
+	rw       gamelogic.RecognitionOfWar
+	received time.Time
+}
+
+// warLedger pairs up the two reports of each war in a room. A war is only
+// fought once both sides reported it and their reports agree, so nobody
+// can make up wars or their outcomes on their own. It also keeps the war
+// the defender declared, for the server to fight it on its board once
+// it's confirmed, whichever of the two comes in first.
+type warLedger struct {
+	pending    map[string]warReport
+	recognized map[string]recognizedWar
+	fought     map[string]time.Time
+	mu         *sync.Mutex
+}
+
+func newWarLedger() *warLedger {
+	return &warLedger{
+		pending:    map[string]warReport{},
+		recognized: map[string]recognizedWar{},
+		fought:     map[string]time.Time{},
+		mu:         &sync.Mutex{},
+	}
+}
+
+func warID(seed int64, attacker, defender, location string) string {
+	return fmt.Sprintf("%v|%s|%s|%s", seed, attacker, defender, location)
+}
+
+// expire must be called with the lock held.
+func (wl *warLedger) expire(now time.Time) {
+	for id, pending := range wl.pending {
+		if now.Sub(pending.received) > warReportTimeout {
+			log.Printf("only %s reported the war: %s", pending.gamelog.Username, pending.gamelog.Message)
+			delete(wl.pending, id)
+		}
+	}
+	for id, recognized := range wl.recognized {
+		if now.Sub(recognized.received) > warReportTimeout {
+			delete(wl.recognized, id)
+		}
+	}
+	for id, fought := range wl.fought {
+		if now.Sub(fought) > warReportTimeout {
+			delete(wl.fought, id)
+		}
+	}
+}
+
+// recognize keeps the war a defender declared, and returns it when both
+// sides already confirmed it.
+func (wl *warLedger) recognize(rw gamelogic.RecognitionOfWar) (gamelogic.RecognitionOfWar, bool) {
+	id := warID(rw.Seed, rw.Attacker.Username, rw.Defender.Username, string(rw.Location()))
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	now := time.Now()
+	wl.expire(now)
+
+	if _, ok := wl.fought[id]; ok {
+		delete(wl.fought, id)
+		return rw, true
+	}
+	wl.recognized[id] = recognizedWar{rw: rw, received: now}
+	return gamelogic.RecognitionOfWar{}, false
+}
+
+// confirm takes a report and returns the war it confirmed, if it was the
+// second one, and the war's id to settle it with once it's logged.
+func (wl *warLedger) confirm(report routing.GameLog) (routing.GameLog, string, bool) {
+	if len(report.Participants) != 2 || report.Participants[0] == report.Participants[1] || !slices.Contains(report.Participants, report.Username) {
+		log.Printf("%s reported a war they didn't fight in: %s", report.Username, report.Message)
+		return routing.GameLog{}, "", false
+	}
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	now := time.Now()
+	wl.expire(now)
+
+	id := warID(report.Seed, report.Participants[0], report.Participants[1], report.Location)
+	first, ok := wl.pending[id]
+	if !ok || first.gamelog.Username == report.Username {
+		wl.pending[id] = warReport{gamelog: report, received: now}
+		return routing.GameLog{}, "", false
+	}
+
+	if first.gamelog.Outcome != report.Outcome || first.gamelog.Winner != report.Winner {
+		log.Printf("%s and %s disagree on their war: %q, %q", first.gamelog.Username, report.Username, first.gamelog.Outcome, report.Outcome)
+		delete(wl.pending, id)
+		return routing.GameLog{}, "", false
+	}
+
+	// the attacker's report goes into the history
+	if first.gamelog.Username == report.Participants[0] {
+		return first.gamelog, id, true
+	}
+	return report, id, true
+}
+
+// settle forgets confirmed wars once they're logged, and returns the ones
+// whose declaration already came in. Until then the first report stays, so
+// a requeued second one confirms the war again.
+func (wl *warLedger) settle(ids []string) []gamelogic.RecognitionOfWar {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	fought := []gamelogic.RecognitionOfWar{}
+	for _, id := range ids {
+		delete(wl.pending, id)
+		recognized, ok := wl.recognized[id]
+		if !ok {
+			wl.fought[id] = time.Now()
+			continue
+		}
+		delete(wl.recognized, id)
+		fought = append(fought, recognized.rw)
+	}
+	return fought
+}
+
+// warHandler fights the wars on the room's board once they're confirmed.
+func warHandler(r *room) func(gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		if !rw.SeedMatches() {
+			log.Printf("%s declared a war on units %s didn't move", rw.Defender.Username, rw.Attacker.Username)
+			return pubsub.NackDiscard
+		}
+		fought, ok := r.wars.recognize(rw)
+		if ok {
+			r.lifecycle.applyWar(fought)
+		}
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	spectatorBuffer = 64
+	feedSize        = 100
+)
+
+// event is what the browsers get over their websocket.
+type event struct {
+	Type        string
+	Time        time.Time
+	Message     string                                `json:",omitempty"`
+	Phase       routing.GamePhase                     `json:",omitempty"`
+	Territories map[gamelogic.Location]map[string]int `json:",omitempty"`
+	Feed        []event                               `json:",omitempty"`
+}
+
+// hub bridges one room's traffic to the websockets watching it. It draws
+// the map from the units the moves and wars showed, spectators see no more
+// than the players do, and keeps the last events for spectators who join
+// late.
+type hub struct {
+	gameID     string
+	id         string
+	queues     []string
+	seen       map[string]map[gamelogic.Location]int
+	phase      routing.GamePhase
+	resolver   gamelogic.CombatResolver
+	feed       []event
+	spectators map[chan []byte]bool
+	mu         *sync.Mutex
+}
+
+// newHub plays by the room's combat rules until its lifecycle says
+// otherwise.
+func newHub(room routing.RoomInfo) *hub {
+	h := &hub{
+		gameID:     room.GameID,
+		id:         strconv.FormatInt(time.Now().UnixNano(), 36),
+		seen:       map[string]map[gamelogic.Location]int{},
+		resolver:   gamelogic.PowerResolver{},
+		feed:       []event{},
+		spectators: map[chan []byte]bool{},
+		mu:         &sync.Mutex{},
+	}
+	h.setCombat(room.Combat)
+	return h
+}
+
+// setCombat must be called with the lock held, or before the hub is
+// shared.
+func (h *hub) setCombat(combat string) {
+	if combat == "" {
+		return
+	}
+	resolver, err := gamelogic.NewCombatResolver(combat)
+	if err != nil {
+		log.Printf("%s plays by %s combat, which the hub doesn't know: %v", h.gameID, combat, err)
+		return
+	}
+	h.resolver = resolver
+}
+
+// queue names a queue of the hub's own, so spectating takes nothing away
+// from the players' and the server's queues.
+func (h *hub) queue(name string) string {
+	queue := routing.GameKey(h.gameID, "spectator", h.id, name)
+	h.queues = append(h.queues, queue)
+	return queue
+}
+
+// subscribe must be followed by close, even when it fails, to delete the
+// queues it already declared.
+func (h *hub) subscribe(conn *amqp.Connection, keys pubsub.KeyRegistry) error {
+	err := pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		h.queue(routing.ArmyMovesPrefix),
+		routing.GameKey(h.gameID, routing.ArmyMovesPrefix, "*"),
+		0,
+		h.handleMove,
+		pubsub.RequireSignature(keys, func(am gamelogic.ArmyMove) string { return am.Player.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to moves: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		h.queue(routing.WarRecognitionsPrefix),
+		routing.GameKey(h.gameID, routing.WarRecognitionsPrefix, "*"),
+		0,
+		h.handleWar,
+		pubsub.RequireSignature(keys, func(rw gamelogic.RecognitionOfWar) string { return rw.Defender.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to wars: %v", err)
+	}
+
+	err = pubsub.SubscribeGOB(
+		conn,
+		routing.ExchangePerilTopic,
+		h.queue(routing.GameLogSlug),
+		routing.GameKey(h.gameID, routing.GameLogSlug, "*"),
+		0,
+		h.handleLog,
+		pubsub.RequireSignature(keys, func(gl routing.GameLog) string { return gl.Username }),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to game logs: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		h.queue(routing.GameLifecycleKey),
+		routing.GameKey(h.gameID, routing.GameLifecycleKey),
+		0,
+		h.handleLifecycle,
+		auth.FromServer[routing.GameLifecycle](keys),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to the game lifecycle: %v", err)
+	}
+	return nil
+}
+
+// close deletes the hub's queues, which ends its subscriptions, and
+// disconnects whoever is still watching.
+func (h *hub) close(conn *amqp.Connection) error {
+	h.mu.Lock()
+	for spectator := range h.spectators {
+		delete(h.spectators, spectator)
+		close(spectator)
+	}
+	h.mu.Unlock()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	errs := []error{}
+	for _, queue := range h.queues {
+		_, err := channel.QueueDelete(queue, false, false, false)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (h *hub) watched() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.spectators) > 0
+}
+
+func (h *hub) join() (chan []byte, []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	spectator := make(chan []byte, spectatorBuffer)
+	h.spectators[spectator] = true
+
+	snapshot, _ := json.Marshal(event{
+		Type:        "snapshot",
+		Time:        time.Now(),
+		Phase:       h.phase,
+		Territories: h.territories(),
+		Feed:        h.feed,
+	})
+	return spectator, snapshot
+}
+
+func (h *hub) leave(spectator chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.spectators[spectator] {
+		delete(h.spectators, spectator)
+		close(spectator)
+	}
+}
+
+// broadcast must be called with the lock held. Spectators that can't keep
+// up are dropped rather than slowing the hub down.
+func (h *hub) broadcast(e event) {
+	if e.Message != "" {
+		h.feed = append(h.feed, e)
+		if len(h.feed) > feedSize {
+			h.feed = h.feed[len(h.feed)-feedSize:]
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("couldn't encode %s event: %v", e.Type, err)
+		return
+	}
+	for spectator := range h.spectators {
+		select {
+		case spectator <- data:
+		default:
+			delete(h.spectators, spectator)
+			close(spectator)
+		}
+	}
+}
+
+// territories counts the units each player was last seen with per
+// location.
+func (h *hub) territories() map[gamelogic.Location]map[string]int {
+	territories := map[gamelogic.Location]map[string]int{}
+	for _, location := range gamelogic.GetLocations() {
+		territories[location] = map[string]int{}
+	}
+	for username, locations := range h.seen {
+		for location, units := range locations {
+			if units > 0 {
+				territories[location][username] = units
+			}
+		}
+	}
+	return territories
+}
+
+// see must be called with the lock held. units are all the player's units
+// in the location.
+func (h *hub) see(username string, location gamelogic.Location, units int) {
+	if h.seen[username] == nil {
+		h.seen[username] = map[gamelogic.Location]int{}
+	}
+	h.seen[username][location] = units
+}
+
+func (h *hub) handleMove(am gamelogic.ArmyMove) pubsub.AckType {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.see(am.Player.Username, am.ToLocation, len(am.Player.Units))
+	h.broadcast(event{
+		Type:        "move",
+		Time:        time.Now(),
+		Message:     fmt.Sprintf("%s moved %v unit(s) to %s", am.Player.Username, len(am.Units), am.ToLocation),
+		Territories: h.territories(),
+	})
+	return pubsub.Ack
+}
+
+func (h *hub) handleWar(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// both sides resolve the war the same way, so the hub can too and
+	// show what's left of them
+	attackerLeft, defenderLeft := rw.Resolve(h.resolver)
+	h.see(rw.Attacker.Username, rw.Location(), len(attackerLeft))
+	h.see(rw.Defender.Username, rw.Location(), len(defenderLeft))
+	h.broadcast(event{
+		Type:        "war",
+		Time:        time.Now(),
+		Message:     fmt.Sprintf("%s and %s are at war in %s", rw.Attacker.Username, rw.Defender.Username, rw.Location()),
+		Territories: h.territories(),
+	})
+	return pubsub.Ack
+}
+
+func (h *hub) handleLog(gamelog routing.GameLog) pubsub.AckType {
+	// both sides report a war, the attacker's report is enough
+	if gamelog.GetEvent() == routing.LogEventWar && len(gamelog.Participants) > 0 && gamelog.Username != gamelog.Participants[0] {
+		return pubsub.Ack
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(event{Type: "log", Time: gamelog.CurrentTime, Message: gamelog.Message})
+	return pubsub.Ack
+}
+
+func (h *hub) handleLifecycle(lc routing.GameLifecycle) pubsub.AckType {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lc.Phase == routing.GamePhaseStarted && h.phase != routing.GamePhaseStarted {
+		h.seen = map[string]map[gamelogic.Location]int{}
+	}
+	h.phase = lc.Phase
+	h.setCombat(lc.Combat)
+
+	message := fmt.Sprintf("the game is in the %s phase", lc.Phase)
+	if lc.Phase == routing.GamePhaseOver {
+		message = "the game is over, nobody won"
+		if lc.Winner != "" {
+			message = fmt.Sprintf("the game is over, %s won", lc.Winner)
+		}
+	}
+	h.broadcast(event{Type: "lifecycle", Time: lc.CurrentTime, Phase: lc.Phase, Message: message, Territories: h.territories()})
+	return pubsub.Ack
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/gorilla/websocket"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	writeTimeout = 10 * time.Second
+	pingPeriod   = 30 * time.Second
+	rpcTimeout   = 5 * time.Second
+)
+
+//go:embed static
+var static embed.FS
+
+// spectator serves the dashboard and bridges each watched room to the
+// browsers over a websocket. Rooms are subscribed to the first time
+// someone watches them, and unsubscribed from once nobody does.
+type spectator struct {
+	conn     *amqp.Connection
+	keys     *auth.RemoteKeyRegistry
+	hubs     map[string]*hub
+	upgrader websocket.Upgrader
+	mu       *sync.Mutex
+}
+
+func main() {
+	configFlags := config.RegisterFlags(flag.CommandLine, false)
+	addr := flag.String("addr", "localhost:8090", "address to serve the dashboard on")
+	flag.Parse()
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		log.Fatalf("couldn't load config: %v", err)
+	}
+
+	log.Println("Connecting to rabbitMq server...")
+
+	conn, err := cfg.Broker.Dial()
+	if err != nil {
+		log.Fatalf("couldnt dial connection with %s: %v\n", cfg.Broker.URL, err)
+	}
+	defer conn.Close()
+
+	keys, err := auth.NewRemoteKeyRegistry(conn, cfg.Keys.Server)
+	if err != nil {
+		log.Fatalf("couldn't subscribe to key changes: %v", err)
+	}
+
+	s := &spectator{
+		conn: conn,
+		keys: keys,
+		hubs: map[string]*hub{},
+		mu:   &sync.Mutex{},
+	}
+
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Fatalf("couldn't load the dashboard: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServer(http.FS(files)))
+	mux.HandleFunc("GET /rooms/{gameID}/ws", s.handleWatch)
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		log.Printf("Serving the spectator dashboard on http://%s", *addr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("spectator dashboard stopped: %v", err)
+		}
+	}()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	<-signalChan
+	log.Println("Shutting down the spectator dashboard...")
+	server.Close()
+}
+
+var errNoRoom = errors.New("no such room")
+
+// watch joins the room's hub, subscribing to the room if it exists and
+// nobody watches it yet.
+func (s *spectator) watch(gameID string) (*hub, chan []byte, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.hubs[gameID]
+	if !ok {
+		room, err := s.findRoom(gameID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		h = newHub(room)
+		err = h.subscribe(s.conn, s.keys)
+		if err != nil {
+			if closeErr := h.close(s.conn); closeErr != nil {
+				log.Printf("couldn't delete the queues of room %s: %v", gameID, closeErr)
+			}
+			return nil, nil, nil, err
+		}
+		s.hubs[gameID] = h
+	}
+
+	events, snapshot := h.join()
+	return h, events, snapshot, nil
+}
+
+// unwatch leaves the hub, and closes it when it was the last spectator.
+func (s *spectator) unwatch(h *hub, events chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h.leave(events)
+	if h.watched() || s.hubs[h.gameID] != h {
+		return
+	}
+	delete(s.hubs, h.gameID)
+	err := h.close(s.conn)
+	if err != nil {
+		log.Printf("couldn't delete the queues of room %s: %v", h.gameID, err)
+	}
+}
+
+func (s *spectator) findRoom(gameID string) (routing.RoomInfo, error) {
+	rooms, err := pubsub.CallJSON[struct{}, []routing.RoomInfo](
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.RoomsListKey,
+		struct{}{},
+		rpcTimeout,
+	)
+	if err != nil {
+		return routing.RoomInfo{}, fmt.Errorf("couldn't list game rooms: %v", err)
+	}
+	for _, room := range rooms {
+		if room.GameID == gameID {
+			return room, nil
+		}
+	}
+	return routing.RoomInfo{}, errNoRoom
+}
+
+// handleWatch sends the room's current state, then every event as it
+// happens. Browsers only listen, anything they send is ignored.
+func (s *spectator) handleWatch(w http.ResponseWriter, r *http.Request) {
+	h, events, snapshot, err := s.watch(r.PathValue("gameID"))
+	if errors.Is(err, errNoRoom) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("couldn't watch room %s: %v", r.PathValue("gameID"), err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer s.unwatch(h, events)
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	go func() {
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				s.unwatch(h, events)
+				return
+			}
+		}
+	}()
+
+	err = writeMessage(ws, snapshot)
+	if err != nil {
+		return
+	}
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case data, ok := <-events:
+			if !ok {
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeTimeout))
+				return
+			}
+			err = writeMessage(ws, data)
+		case <-ping.C:
+			err = ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeMessage(ws *websocket.Conn, data []byte) error {
+	ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return ws.WriteMessage(websocket.TextMessage, data)
+}
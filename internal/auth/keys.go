@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrUnknownKey    = errors.New("player has no registered signing key")
+	ErrInvalidKey    = errors.New("signing key is not an ed25519 public key")
+	ErrKeyRegistered = errors.New("another signing key is registered for the player, rotate it with the old key")
+	ErrUnsignedKey   = errors.New("the key wasn't signed by the pinned server key")
+)
+
+// KeyStore is the server's registry of the players' public signing keys,
+// kept in a JSON file like the credentials. A player has a single key. It
+// is only replaced by a rotation signed with the old key, a player who lost
+// theirs needs an operator to remove it from the file.
+type KeyStore struct {
+	path   string
+	keys   map[string][]byte
+	signer pubsub.Signer
+	mu     *sync.RWMutex
+}
+
+func NewKeyStore(path string) (*KeyStore, error) {
+	store := &KeyStore{
+		path: path,
+		keys: map[string][]byte{},
+		mu:   &sync.RWMutex{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read keys file: %v", err)
+	}
+
+	err = json.Unmarshal(data, &store.keys)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse keys file: %v", err)
+	}
+	return store, nil
+}
+
+// Register reports whether the player's key changed. Registering the key
+// they already have changes nothing, a different one needs rotation: the
+// new key signed with the registered one.
+func (ks *KeyStore) Register(username string, key, rotation []byte) (bool, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return false, ErrInvalidKey
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	previous, existed := ks.keys[username]
+	if existed && bytes.Equal(previous, key) {
+		return false, nil
+	}
+	if existed && !ed25519.Verify(previous, key, rotation) {
+		return false, ErrKeyRegistered
+	}
+	ks.keys[username] = key
+
+	err := ks.save()
+	if err != nil {
+		if existed {
+			ks.keys[username] = previous
+		} else {
+			delete(ks.keys, username)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ServerSigner loads the server's own signing key from path, making it the
+// first time, and registers it as routing.ServerSigner. The store signs the
+// keys it looks up with it.
+func (ks *KeyStore) ServerSigner(path string) (pubsub.Signer, error) {
+	private, err := readSigningKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return pubsub.Signer{}, err
+		}
+		err = writeSigningKey(path, private)
+	}
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+
+	signer := pubsub.Signer{Username: routing.ServerSigner, Key: private}
+	ks.mu.Lock()
+	ks.keys[routing.ServerSigner] = private.Public().(ed25519.PublicKey)
+	ks.signer = signer
+	err = ks.save()
+	ks.mu.Unlock()
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+	return signer, nil
+}
+
+// Lookup is the player's key signed by the server, what keys.lookup
+// answers with.
+func (ks *KeyStore) Lookup(username string) (routing.PublicKey, error) {
+	key, err := ks.PublicKey(username)
+	if err != nil {
+		return routing.PublicKey{}, err
+	}
+
+	ks.mu.RLock()
+	signer := ks.signer
+	ks.mu.RUnlock()
+	if signer.Key == nil {
+		return routing.PublicKey{}, errors.New("the server has no signing key")
+	}
+	return routing.PublicKey{
+		Username:  username,
+		PublicKey: key,
+		Signature: ed25519.Sign(signer.Key, keyClaim(username, key)),
+	}, nil
+}
+
+func (ks *KeyStore) PublicKey(username string) (ed25519.PublicKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[username]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func (ks *KeyStore) save() error {
+	data, err := json.MarshalIndent(ks.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := ks.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write keys file: %v", err)
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+// keyClaim is what the server signs when it vouches for a player's key.
+func keyClaim(username string, key []byte) []byte {
+	return append([]byte("peril-key\x00"+username+"\x00"), key...)
+}
+
+// WriteServerKey pins the server's public key at path, for the clients that
+// run next to the server.
+func WriteServerKey(path string, key ed25519.PublicKey) error {
+	err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write server key: %v", err)
+	}
+	return nil
+}
+
+func readServerKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", path)
+	}
+	return key, nil
+}
+
+// SigningKeyPath is where a player's private key is kept in dir.
+func SigningKeyPath(dir, username string) string {
+	return filepath.Join(dir, username+".signing.key")
+}
+
+// RegisterSigningKey registers the session's player's key kept at path
+// with the server, making the key the first time.
+func RegisterSigningKey(conn *amqp.Connection, session pubsub.Session, path string) (pubsub.Signer, error) {
+	private, err := readSigningKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return pubsub.Signer{}, err
+		}
+		err = writeSigningKey(path, private)
+	}
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+
+	err = registerKey(conn, session, private.Public().(ed25519.PublicKey), nil)
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+	return pubsub.Signer{Username: session.Username, Key: private}, nil
+}
+
+// RotateSigningKey replaces the key kept at path with a new one, which the
+// server only takes because the old key signed it.
+func RotateSigningKey(conn *amqp.Connection, session pubsub.Session, path string) (pubsub.Signer, error) {
+	old, err := readSigningKey(path)
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+
+	err = registerKey(conn, session, public, ed25519.Sign(old, public))
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+	err = writeSigningKey(path, private)
+	if err != nil {
+		return pubsub.Signer{}, err
+	}
+	return pubsub.Signer{Username: session.Username, Key: private}, nil
+}
+
+func registerKey(conn *amqp.Connection, session pubsub.Session, public ed25519.PublicKey, rotation []byte) error {
+	_, err := pubsub.CallJSON[routing.PublicKeyRegistration, struct{}](
+		conn,
+		"",
+		routing.KeysRegisterKey,
+		routing.PublicKeyRegistration{Username: session.Username, Token: session.Token, PublicKey: public, Rotation: rotation},
+		rpcTimeout,
+	)
+	return err
+}
+
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	seed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s is not an ed25519 signing key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func writeSigningKey(path string, key ed25519.PrivateKey) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, key.Seed(), 0600)
+	if err != nil {
+		return fmt.Errorf("could not write signing key: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// RemoteKeyRegistry looks keys up with the server's keys.lookup rpc and
+// keeps them until the server announces that the player registered a new
+// one. Anyone on the broker could answer the rpc, so only answers signed
+// with the server's pinned key count.
+type RemoteKeyRegistry struct {
+	conn   *amqp.Connection
+	server ed25519.PublicKey
+	keys   map[string]ed25519.PublicKey
+	mu     *sync.Mutex
+}
+
+// NewRemoteKeyRegistry trusts the server key pinned at serverKeyPath. The
+// first time, there's nothing pinned yet and the key the server answers
+// with is pinned, like ssh does with hosts.
+func NewRemoteKeyRegistry(conn *amqp.Connection, serverKeyPath string) (*RemoteKeyRegistry, error) {
+	kr := &RemoteKeyRegistry{
+		conn: conn,
+		keys: map[string]ed25519.PublicKey{},
+		mu:   &sync.Mutex{},
+	}
+
+	server, err := readServerKey(serverKeyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		server, err = kr.pinServerKey(serverKeyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kr.server = server
+	kr.keys[routing.ServerSigner] = server
+
+	// the broker names the queue, so every registry gets its own copy of
+	// the announcements
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		"",
+		routing.KeysChangedPrefix+".*",
+		0,
+		func(changed routing.PublicKey) pubsub.AckType {
+			if changed.Username == routing.ServerSigner {
+				return pubsub.Ack
+			}
+			kr.forget(changed.Username)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+func (kr *RemoteKeyRegistry) PublicKey(username string) (ed25519.PublicKey, error) {
+	kr.mu.Lock()
+	key, ok := kr.keys[username]
+	kr.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	resp, err := kr.lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(kr.server, keyClaim(username, resp.PublicKey), resp.Signature) {
+		return nil, ErrUnsignedKey
+	}
+
+	kr.mu.Lock()
+	kr.keys[username] = resp.PublicKey
+	kr.mu.Unlock()
+	return resp.PublicKey, nil
+}
+
+// FromServer only takes messages the server signed, the ones that say
+// how the game goes.
+func FromServer[T any](keys pubsub.KeyRegistry) pubsub.SubscribeOption[T] {
+	return pubsub.RequireSignature(keys, func(T) string { return routing.ServerSigner })
+}
+
+func (kr *RemoteKeyRegistry) lookup(username string) (routing.PublicKey, error) {
+	resp, err := pubsub.CallJSON[routing.PublicKey, routing.PublicKey](
+		kr.conn,
+		routing.ExchangePerilTopic,
+		routing.KeysLookupKey,
+		routing.PublicKey{Username: username},
+		rpcTimeout,
+	)
+	if err != nil {
+		return routing.PublicKey{}, err
+	}
+	if resp.Username != username || len(resp.PublicKey) != ed25519.PublicKeySize {
+		return routing.PublicKey{}, ErrInvalidKey
+	}
+	return resp, nil
+}
+
+// pinServerKey takes the server's word for its own key, it can only check
+// that the key signed itself.
+func (kr *RemoteKeyRegistry) pinServerKey(path string) (ed25519.PublicKey, error) {
+	resp, err := kr.lookup(routing.ServerSigner)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't look up the server's key: %v", err)
+	}
+	if !ed25519.Verify(resp.PublicKey, keyClaim(routing.ServerSigner, resp.PublicKey), resp.Signature) {
+		return nil, ErrUnsignedKey
+	}
+
+	err = WriteServerKey(path, resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("pinned the server's key %x in %s, delete it if the server's key changed", resp.PublicKey, path)
+	return resp.PublicKey, nil
+}
+
+func (kr *RemoteKeyRegistry) forget(username string) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	delete(kr.keys, username)
+}
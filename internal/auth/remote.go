@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const rpcTimeout = 5 * time.Second
+
+func Register(conn *amqp.Connection, username, password string) error {
+	_, err := pubsub.CallJSON[routing.Credentials, struct{}](
+		conn,
+		"",
+		routing.AuthRegisterKey,
+		routing.Credentials{Username: username, Password: password},
+		rpcTimeout,
+	)
+	return err
+}
+
+func Login(conn *amqp.Connection, username, password string) (pubsub.Session, error) {
+	token, err := pubsub.CallJSON[routing.Credentials, routing.SessionToken](
+		conn,
+		"",
+		routing.AuthLoginKey,
+		routing.Credentials{Username: username, Password: password},
+		rpcTimeout,
+	)
+	if err != nil {
+		return pubsub.Session{}, err
+	}
+	return pubsub.Session{Username: token.Username, Token: token.Token, Inbox: token.Inbox}, nil
+}
+
+// LoginOrRegister is for unattended players like bots, which register
+// themselves the first time they log in.
+func LoginOrRegister(conn *amqp.Connection, username, password string) (pubsub.Session, error) {
+	session, err := Login(conn, username, password)
+	if !IsUnknownUser(err) {
+		return session, err
+	}
+
+	err = Register(conn, username, password)
+	if err != nil {
+		return pubsub.Session{}, err
+	}
+	return Login(conn, username, password)
+}
+
+// errors that crossed an rpc call only keep their text
+func IsUnknownUser(err error) bool {
+	return err != nil && err.Error() == ErrUnknownUser.Error()
+}
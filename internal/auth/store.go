@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownUser      = errors.New("unknown user")
+	ErrUserExists       = errors.New("username is already taken")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrInvalidUsername  = errors.New("username must be 1-32 letters, digits, - or _")
+	ErrPasswordTooShort = errors.New("password must be at least 6 characters")
+)
+
+const minPasswordLength = 6
+
+type credential struct {
+	PasswordHash []byte
+	CreatedAt    time.Time
+}
+
+// CredentialStore keeps bcrypt password hashes in a JSON file, rewritten
+// whenever a player registers.
+type CredentialStore struct {
+	path        string
+	credentials map[string]credential
+	mu          *sync.RWMutex
+}
+
+func NewCredentialStore(path string) (*CredentialStore, error) {
+	store := &CredentialStore{
+		path:        path,
+		credentials: map[string]credential{},
+		mu:          &sync.RWMutex{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials file: %v", err)
+	}
+
+	err = json.Unmarshal(data, &store.credentials)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse credentials file: %v", err)
+	}
+	return store, nil
+}
+
+func (cs *CredentialStore) Register(username, password string) error {
+	if !ValidUsername(username) {
+		return ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, ok := cs.credentials[username]; ok {
+		return ErrUserExists
+	}
+	cs.credentials[username] = credential{PasswordHash: hash, CreatedAt: time.Now()}
+
+	err = cs.save()
+	if err != nil {
+		delete(cs.credentials, username)
+		return err
+	}
+	return nil
+}
+
+func (cs *CredentialStore) Verify(username, password string) error {
+	cs.mu.RLock()
+	cred, ok := cs.credentials[username]
+	cs.mu.RUnlock()
+
+	if !ok {
+		return ErrUnknownUser
+	}
+	if bcrypt.CompareHashAndPassword(cred.PasswordHash, []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (cs *CredentialStore) save() error {
+	data, err := json.MarshalIndent(cs.credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := cs.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write credentials file: %v", err)
+	}
+	return os.Rename(tmp, cs.path)
+}
+
+func ValidUsername(username string) bool {
+	if len(username) == 0 || len(username) > 32 {
+		return false
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
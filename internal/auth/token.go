@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token has expired")
+)
+
+const (
+	sessionTTL = 12 * time.Hour
+	secretSize = 32
+)
+
+// TokenIssuer hands out stateless session tokens: the username and expiry
+// signed with a secret that never leaves the server. Every server started
+// with the same secret file accepts the tokens of the others.
+type TokenIssuer struct {
+	secret []byte
+}
+
+func NewTokenIssuer(secretPath string) (*TokenIssuer, error) {
+	secret, err := os.ReadFile(secretPath)
+	if errors.Is(err, os.ErrNotExist) {
+		secret = make([]byte, secretSize)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(secretPath, secret, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not write session secret: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read session secret: %v", err)
+	}
+
+	return &TokenIssuer{secret: secret}, nil
+}
+
+func (ti *TokenIssuer) Issue(username string) routing.SessionToken {
+	expiresAt := time.Now().Add(sessionTTL).Truncate(time.Second)
+	payload := fmt.Sprintf("%s|%d", username, expiresAt.Unix())
+
+	return routing.SessionToken{
+		Username: username,
+		Token: fmt.Sprintf(
+			"%s.%s",
+			base64.RawURLEncoding.EncodeToString([]byte(payload)),
+			base64.RawURLEncoding.EncodeToString(ti.sign(payload)),
+		),
+		Inbox:     ti.Inbox(username),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Inbox is the player's secret routing key suffix. It's derived from the
+// secret, so it stays the same across sessions and servers. Usernames
+// can't hold a colon, so no token payload is ever signed the same. It's
+// only secret while players can't list the broker's queues and bindings.
+func (ti *TokenIssuer) Inbox(username string) string {
+	return base64.RawURLEncoding.EncodeToString(ti.sign("inbox:" + username)[:18])
+}
+
+func (ti *TokenIssuer) Authenticate(session pubsub.Session) error {
+	encodedPayload, encodedSignature, ok := strings.Cut(session.Token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if !hmac.Equal(signature, ti.sign(string(payload))) {
+		return ErrInvalidToken
+	}
+
+	username, expiry, ok := strings.Cut(string(payload), "|")
+	if !ok || username != session.Username {
+		return ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+func (ti *TokenIssuer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, ti.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
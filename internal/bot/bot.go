@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type Bot struct {
+	GameState *gamelogic.GameState
+	gameID    string
+	strategy  Strategy
+	transport Transport
+	rng       *rand.Rand
+	mu        *sync.Mutex
+}
+
+func New(username, gameID string, strategy Strategy, transport Transport, seed int64) *Bot {
+	return &Bot{
+		GameState: gamelogic.NewGameState(username),
+		gameID:    gameID,
+		strategy:  strategy,
+		transport: transport,
+		rng:       rand.New(rand.NewSource(seed)),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (b *Bot) Start() error {
+	username := b.GameState.GetUsername()
+
+	err := b.transport.Subscribe(
+		routing.ExchangePerilDirect,
+		routing.GameKey(b.gameID, routing.PauseKey, username),
+		routing.GameKey(b.gameID, routing.PauseKey),
+		decodeJSON(b.handlePause),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = b.transport.Subscribe(
+		routing.ExchangePerilTopic,
+		routing.GameKey(b.gameID, routing.ArmyMovesPrefix, username),
+		routing.GameKey(b.gameID, routing.ArmyMovesPrefix, "*"),
+		decodeJSON(b.handleMove),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = b.transport.Subscribe(
+		routing.ExchangePerilTopic,
+		routing.GameKey(b.gameID, routing.WarRecognitionsPrefix, username),
+		routing.GameKey(b.gameID, routing.WarRecognitionsPrefix, "*"),
+		decodeJSON(b.handleWar),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = b.transport.Subscribe(
+		routing.ExchangePerilDirect,
+		routing.GameKey(b.gameID, routing.GameLifecycleKey, username),
+		routing.GameKey(b.gameID, routing.GameLifecycleKey),
+		decodeJSON(b.handleLifecycle),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = b.transport.PublishJSON(
+		routing.ExchangePerilTopic,
+		routing.GameKey(b.gameID, routing.LobbyPrefix, username),
+		routing.LobbyRegistration{CurrentTime: time.Now(), Username: username},
+	)
+	if err != nil {
+		return err
+	}
+	return b.heartbeat(false)
+}
+
+// Run plays a turn every interval and keeps telling the server the bot is
+// there, like a client does, until done is closed.
+func (b *Bot) Run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	heartbeats := time.NewTicker(routing.HeartbeatInterval)
+	defer heartbeats.Stop()
+
+	for {
+		select {
+		case <-done:
+			b.heartbeat(true)
+			return
+		case <-heartbeats.C:
+			err := b.heartbeat(false)
+			if err != nil {
+				fmt.Printf("%s couldn't send a heartbeat: %v\n", b.GameState.GetUsername(), err)
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		err := b.Step()
+		if err != nil {
+			fmt.Printf("%s couldn't play its turn: %v\n", b.GameState.GetUsername(), err)
+		}
+	}
+}
+
+// Step asks the strategy for one command and plays it through the same
+// GameState commands and publishes the client uses.
+func (b *Bot) Step() error {
+	b.mu.Lock()
+	view := View{Self: b.GameState.GetPlayerSnap(), Enemies: b.GameState.GetLastKnownEnemies()}
+	words := b.strategy.Next(view, b.rng)
+	b.mu.Unlock()
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	switch words[0] {
+	case "spawn":
+		err := b.GameState.CommandSpawn(words)
+		if err != nil {
+			return err
+		}
+	case "move":
+		armyMove, err := b.GameState.CommandMove(words)
+		if err != nil {
+			return err
+		}
+		err = b.transport.PublishJSON(
+			routing.ExchangePerilTopic,
+			routing.GameKey(b.gameID, routing.ArmyMovesPrefix, b.GameState.GetUsername()),
+			armyMove,
+		)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("strategy %s picked an unknown command: %s", b.strategy.Name(), words[0])
+	}
+
+	return b.publishStatus()
+}
+
+func (b *Bot) heartbeat(leaving bool) error {
+	username := b.GameState.GetUsername()
+	return b.transport.PublishJSON(
+		routing.ExchangePerilTopic,
+		routing.GameKey(b.gameID, routing.PresencePrefix, username),
+		routing.Heartbeat{CurrentTime: time.Now(), Username: username, Leaving: leaving},
+	)
+}
+
+func (b *Bot) publishStatus() error {
+	return b.transport.PublishJSON(
+		routing.ExchangePerilDirect,
+		routing.GameKey(b.gameID, routing.PlayerStatusPrefix, b.transport.Inbox()),
+		b.GameState.GetPlayerSnap(),
+	)
+}
+
+func (b *Bot) handleLifecycle(lc routing.GameLifecycle) pubsub.AckType {
+	b.GameState.HandleLifecycle(lc)
+	return pubsub.Ack
+}
+
+func (b *Bot) handlePause(ps routing.PlayingState) pubsub.AckType {
+	b.GameState.HandlePause(ps)
+	return pubsub.Ack
+}
+
+func (b *Bot) handleMove(am gamelogic.ArmyMove) pubsub.AckType {
+	outcome := b.GameState.HandleMove(am)
+
+	if outcome == gamelogic.MoveOutComeSafe {
+		return pubsub.Ack
+	}
+
+	if outcome == gamelogic.MoveOutcomeMakeWar {
+		err := b.transport.PublishJSON(
+			routing.ExchangePerilTopic,
+			routing.GameKey(b.gameID, routing.WarRecognitionsPrefix, b.GameState.GetUsername()),
+			b.GameState.RecognizeWar(am),
+		)
+		if err != nil {
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+
+	return pubsub.NackDiscard
+}
+
+func (b *Bot) handleWar(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+	warOutcome, winner, loser := b.GameState.HandleWar(rw)
+
+	switch warOutcome {
+	case gamelogic.WarOutcomeNotInvolved:
+		return pubsub.Ack
+	case gamelogic.WarOutcomeNoUnits:
+		return pubsub.NackDiscard
+	}
+
+	err := b.publishStatus()
+	if err != nil {
+		return pubsub.NackRequeue
+	}
+
+	// both sides report the war, the server only counts it when they agree
+	err = b.transport.PublishGob(
+		routing.ExchangePerilTopic,
+		routing.GameKey(b.gameID, routing.GameLogSlug, b.GameState.GetUsername()),
+		b.GameState.WarLog(b.gameID, rw, warOutcome, winner, loser),
+	)
+	if err != nil {
+		return pubsub.NackRequeue
+	}
+	return pubsub.Ack
+}
+
+func decodeJSON[T any](handler func(T) pubsub.AckType) func([]byte) pubsub.AckType {
+	return func(body []byte) pubsub.AckType {
+		var val T
+		err := json.Unmarshal(body, &val)
+		if err != nil {
+			return pubsub.NackDiscard
+		}
+		return handler(val)
+	}
+}
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// View is everything a strategy may look at when picking its next command:
+// its own units and the last known positions of the enemy units it saw.
+type View struct {
+	Self    gamelogic.Player
+	Enemies map[string]gamelogic.Player
+}
+
+// Strategy picks the next command for a bot, in the same words a player
+// would type into the client. Returning nil skips the turn.
+type Strategy interface {
+	Name() string
+	Next(view View, rng *rand.Rand) []string
+}
+
+func GetStrategy(name string) (Strategy, error) {
+	switch name {
+	case "random":
+		return RandomStrategy{}, nil
+	case "aggressive":
+		return AggressiveStrategy{MinArmy: 3}, nil
+	case "turtle":
+		return &TurtleStrategy{}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy: %s", name)
+}
+
+func GetStrategyNames() []string {
+	return []string{"random", "aggressive", "turtle"}
+}
+
+type RandomStrategy struct{}
+
+func (RandomStrategy) Name() string {
+	return "random"
+}
+
+func (RandomStrategy) Next(view View, rng *rand.Rand) []string {
+	if len(view.Self.Units) == 0 || rng.Intn(2) == 0 {
+		return spawnCommand(randomLocation(rng), randomRank(rng))
+	}
+
+	ids := sortedUnitIDs(view.Self)
+	return moveCommand(randomLocation(rng), ids[rng.Intn(len(ids))])
+}
+
+// AggressiveStrategy builds a strike force of the heaviest units and throws
+// all of it at the location where the weakest opponent is camped.
+type AggressiveStrategy struct {
+	MinArmy int
+}
+
+func (AggressiveStrategy) Name() string {
+	return "aggressive"
+}
+
+func (as AggressiveStrategy) Next(view View, rng *rand.Rand) []string {
+	ranks := gamelogic.GetRanksByPower()
+	if len(view.Self.Units) < as.MinArmy {
+		heaviest := ranks[:min(2, len(ranks))]
+		return spawnCommand(randomLocation(rng), heaviest[rng.Intn(len(heaviest))])
+	}
+
+	target, ok := weakestEnemyLocation(view)
+	if !ok {
+		return spawnCommand(randomLocation(rng), ranks[0])
+	}
+
+	ids := []int{}
+	for _, id := range sortedUnitIDs(view.Self) {
+		if view.Self.Units[id].Location != target {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return spawnCommand(target, ranks[0])
+	}
+	return moveCommand(target, ids...)
+}
+
+// TurtleStrategy picks a home location, fortifies it with its lightest and
+// heaviest units and pulls back any unit that ended up elsewhere.
+type TurtleStrategy struct {
+	home gamelogic.Location
+}
+
+func (*TurtleStrategy) Name() string {
+	return "turtle"
+}
+
+func (ts *TurtleStrategy) Next(view View, rng *rand.Rand) []string {
+	if ts.home == "" {
+		ts.home = quietestLocation(view, rng)
+	}
+
+	for _, id := range sortedUnitIDs(view.Self) {
+		if view.Self.Units[id].Location != ts.home {
+			return moveCommand(ts.home, id)
+		}
+	}
+
+	ranks := gamelogic.GetRanksByPower()
+	fortifications := []gamelogic.UnitRank{ranks[len(ranks)-1], ranks[0]}
+	return spawnCommand(ts.home, fortifications[rng.Intn(len(fortifications))])
+}
+
+func spawnCommand(location gamelogic.Location, rank gamelogic.UnitRank) []string {
+	return []string{"spawn", string(location), string(rank)}
+}
+
+func moveCommand(location gamelogic.Location, ids ...int) []string {
+	words := []string{"move", string(location)}
+	for _, id := range ids {
+		words = append(words, strconv.Itoa(id))
+	}
+	return words
+}
+
+func randomLocation(rng *rand.Rand) gamelogic.Location {
+	locations := gamelogic.GetLocations()
+	return locations[rng.Intn(len(locations))]
+}
+
+func randomRank(rng *rand.Rand) gamelogic.UnitRank {
+	ranks := gamelogic.GetRanks()
+	return ranks[rng.Intn(len(ranks))]
+}
+
+func sortedUnitIDs(player gamelogic.Player) []int {
+	ids := []int{}
+	for id := range player.Units {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func enemyUnitsByLocation(view View) map[gamelogic.Location]int {
+	units := map[gamelogic.Location]int{}
+	for _, enemy := range view.Enemies {
+		for _, unit := range enemy.Units {
+			units[unit.Location]++
+		}
+	}
+	return units
+}
+
+func weakestEnemyLocation(view View) (gamelogic.Location, bool) {
+	units := enemyUnitsByLocation(view)
+	best := gamelogic.Location("")
+	bestCount := 0
+	for _, location := range gamelogic.GetLocations() {
+		count := units[location]
+		if count == 0 {
+			continue
+		}
+		if best == "" || count < bestCount {
+			best = location
+			bestCount = count
+		}
+	}
+	return best, best != ""
+}
+
+func quietestLocation(view View, rng *rand.Rand) gamelogic.Location {
+	units := enemyUnitsByLocation(view)
+	quietest := []gamelogic.Location{}
+	for _, location := range gamelogic.GetLocations() {
+		if units[location] == 0 {
+			quietest = append(quietest, location)
+		}
+	}
+	if len(quietest) == 0 {
+		return randomLocation(rng)
+	}
+	return quietest[rng.Intn(len(quietest))]
+}
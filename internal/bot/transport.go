@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transport carries a bot's messages. Inbox is the secret its session got
+// for the keys only it and the server know.
+type Transport interface {
+	PublishJSON(exchange, key string, val any) error
+	PublishGob(exchange, key string, val any) error
+	Subscribe(exchange, queueName, key string, handler func([]byte) pubsub.AckType) error
+	Inbox() string
+}
+
+// AMQPTransport signs what the bot publishes. With a key registry it also
+// drops deliveries that aren't signed by who they claim to come from.
+type AMQPTransport struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	signer  pubsub.Signer
+	inbox   string
+	keys    pubsub.KeyRegistry
+}
+
+func NewAMQPTransport(conn *amqp.Connection, signer pubsub.Signer, inbox string, keys pubsub.KeyRegistry) (*AMQPTransport, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return &AMQPTransport{
+		conn:    conn,
+		channel: channel,
+		signer:  signer,
+		inbox:   inbox,
+		keys:    keys,
+	}, nil
+}
+
+func (t *AMQPTransport) Inbox() string {
+	return t.inbox
+}
+
+func (t *AMQPTransport) PublishJSON(exchange, key string, val any) error {
+	return pubsub.PublishJSON(t.channel, exchange, key, val, pubsub.WithSignature(t.signer))
+}
+
+func (t *AMQPTransport) PublishGob(exchange, key string, val any) error {
+	return pubsub.PublishGob(t.channel, exchange, key, val, pubsub.WithSignature(t.signer))
+}
+
+// Subscribe checks that a message's sender signed it and is who the message
+// claims to come from, like the client does. What comes over the direct
+// exchange is the server's, it must be signed by the server.
+func (t *AMQPTransport) Subscribe(exchange, queueName, key string, handler func([]byte) pubsub.AckType) error {
+	opts := []pubsub.SubscribeOption[json.RawMessage]{}
+	if t.keys != nil && exchange == routing.ExchangePerilTopic {
+		claimant, err := topicClaimant(key)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, pubsub.RequireSignature(t.keys, claimant))
+	}
+	if t.keys != nil && exchange == routing.ExchangePerilDirect {
+		opts = append(opts, pubsub.RequireSignature(t.keys, func(json.RawMessage) string { return routing.ServerSigner }))
+	}
+
+	return pubsub.SubscribeJSON(t.conn, exchange, queueName, key, 0, func(body json.RawMessage) pubsub.AckType {
+		return handler(body)
+	}, opts...)
+}
+
+// topicClaimant says who a message under a game's key claims to come from.
+// A body that doesn't decode claims no one, so no signature matches it.
+func topicClaimant(key string) (func(json.RawMessage) string, error) {
+	words := strings.Split(key, ".")
+	if len(words) < 2 {
+		return nil, fmt.Errorf("no claimant for %s", key)
+	}
+
+	switch words[1] {
+	case routing.ArmyMovesPrefix:
+		return func(body json.RawMessage) string {
+			var am gamelogic.ArmyMove
+			if json.Unmarshal(body, &am) != nil {
+				return ""
+			}
+			return am.Player.Username
+		}, nil
+	case routing.WarRecognitionsPrefix:
+		return func(body json.RawMessage) string {
+			var rw gamelogic.RecognitionOfWar
+			if json.Unmarshal(body, &rw) != nil {
+				return ""
+			}
+			return rw.Defender.Username
+		}, nil
+	case routing.DiplomacyPrefix:
+		return func(body json.RawMessage) string {
+			var d gamelogic.Diplomacy
+			if json.Unmarshal(body, &d) != nil {
+				return ""
+			}
+			return d.From
+		}, nil
+	}
+	return nil, fmt.Errorf("no claimant for %s", key)
+}
+
+const memoryQueueSize = 4096
+
+// MemoryTransport is an in-process stand-in for the broker. Queues are
+// shared by name like on rabbitMq, so several subscribers of one queue
+// compete for its messages, and routing keys are matched with the topic
+// exchange's * and # wildcards.
+type MemoryTransport struct {
+	queues map[string]*memoryQueue
+	mu     *sync.Mutex
+}
+
+type memoryQueue struct {
+	exchange string
+	key      string
+	messages chan []byte
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		queues: map[string]*memoryQueue{},
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Inbox is empty, without a server there are no secrets to keep.
+func (t *MemoryTransport) Inbox() string {
+	return ""
+}
+
+func (t *MemoryTransport) PublishJSON(exchange, key string, val any) error {
+	body, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	t.publish(exchange, key, body)
+	return nil
+}
+
+func (t *MemoryTransport) PublishGob(exchange, key string, val any) error {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(val)
+	if err != nil {
+		return err
+	}
+	t.publish(exchange, key, buffer.Bytes())
+	return nil
+}
+
+func (t *MemoryTransport) publish(exchange, key string, body []byte) {
+	t.mu.Lock()
+	matching := []*memoryQueue{}
+	for _, queue := range t.queues {
+		if queue.exchange == exchange && MatchTopic(queue.key, key) {
+			matching = append(matching, queue)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, queue := range matching {
+		queue.messages <- body
+	}
+}
+
+func (t *MemoryTransport) Subscribe(exchange, queueName, key string, handler func([]byte) pubsub.AckType) error {
+	t.mu.Lock()
+	queue, ok := t.queues[queueName]
+	if !ok {
+		queue = &memoryQueue{
+			exchange: exchange,
+			key:      key,
+			messages: make(chan []byte, memoryQueueSize),
+		}
+		t.queues[queueName] = queue
+	}
+	t.mu.Unlock()
+
+	go func() {
+		for body := range queue.messages {
+			if handler(body) == pubsub.NackRequeue {
+				go func(body []byte) { queue.messages <- body }(body)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func MatchTopic(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	if pattern[0] == "#" {
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(key) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && pattern[0] != key[0] {
+		return false
+	}
+	return matchWords(pattern[1:], key[1:])
+}
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func (b Broker) Dial() (*amqp.Connection, error) {
+	return pubsub.Dial(b.URL, pubsub.DialOptions{
+		CA:         b.CA,
+		Cert:       b.Cert,
+		Key:        b.Key,
+		ServerName: b.ServerName,
+		External:   b.External,
+	})
+}
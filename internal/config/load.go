@@ -0,0 +1,160 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Flags are the settings every binary takes on its command line.
+type Flags struct {
+	fs         *flag.FlagSet
+	path       string
+	url        string
+	ca         string
+	cert       string
+	key        string
+	serverName string
+	external   bool
+	logs       string
+	withLogs   bool
+}
+
+// RegisterFlags adds -config, -url, -ca, -cert, -key, -server-name and
+// -external to fs, and -logs when withLogs is set, for the server.
+func RegisterFlags(fs *flag.FlagSet, withLogs bool) *Flags {
+	defaults := Default()
+	f := &Flags{fs: fs, withLogs: withLogs}
+	fs.StringVar(&f.path, "config", os.Getenv("PERIL_CONFIG"), "yaml config file, defaults to $PERIL_CONFIG")
+	fs.StringVar(&f.url, "url", defaults.Broker.URL, "rabbitMq connection url")
+	fs.StringVar(&f.ca, "ca", "", "CA certificate to trust the broker with")
+	fs.StringVar(&f.cert, "cert", "", "client certificate to show the broker")
+	fs.StringVar(&f.key, "key", "", "key of the client certificate")
+	fs.StringVar(&f.serverName, "server-name", "", "name to verify the broker's certificate against, defaults to the url's host")
+	fs.BoolVar(&f.external, "external", false, "log in to the broker with the client certificate (SASL EXTERNAL)")
+	if withLogs {
+		fs.StringVar(&f.logs, "logs", defaults.Logs.Sinks, "where to keep game logs: comma separated file:<path>, sqlite:<path> and stdout")
+	}
+	return f
+}
+
+// Load builds the config once the flags are parsed, validates it and
+// applies it.
+func (f *Flags) Load() (Config, error) {
+	cfg := Default()
+
+	if f.path != "" {
+		err := readFile(f.path, &cfg)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	err := readEnv(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "url":
+			cfg.Broker.URL = f.url
+		case "ca":
+			cfg.Broker.CA = f.ca
+		case "cert":
+			cfg.Broker.Cert = f.cert
+		case "key":
+			cfg.Broker.Key = f.key
+		case "server-name":
+			cfg.Broker.ServerName = f.serverName
+		case "external":
+			cfg.Broker.External = f.external
+		case "logs":
+			if f.withLogs {
+				cfg.Logs.Sinks = f.logs
+			}
+		}
+	})
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	cfg.Apply()
+	return cfg, nil
+}
+
+// readFile overrides what the file sets. A map in the file replaces the
+// default one as a whole rather than adding to it.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %v", err)
+	}
+
+	file := Config{}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	if file.Map.Locations != nil {
+		cfg.Map.Locations = file.Map.Locations
+	}
+	if file.Map.Ranks != nil {
+		cfg.Map.Ranks = file.Map.Ranks
+	}
+	return nil
+}
+
+func readEnv(cfg *Config) error {
+	settings := map[string]*string{
+		"PERIL_BROKER_URL":           &cfg.Broker.URL,
+		"PERIL_BROKER_CA":            &cfg.Broker.CA,
+		"PERIL_BROKER_CERT":          &cfg.Broker.Cert,
+		"PERIL_BROKER_KEY":           &cfg.Broker.Key,
+		"PERIL_BROKER_SERVER_NAME":   &cfg.Broker.ServerName,
+		"PERIL_EXCHANGE_DIRECT":      &cfg.Exchanges.Direct,
+		"PERIL_EXCHANGE_TOPIC":       &cfg.Exchanges.Topic,
+		"PERIL_EXCHANGE_DEAD_LETTER": &cfg.Exchanges.DeadLetter,
+		"PERIL_GAME_COMBAT":          &cfg.Game.Combat,
+		"PERIL_SERVER_KEY":           &cfg.Keys.Server,
+		"PERIL_LOGS":                 &cfg.Logs.Sinks,
+	}
+	for name, setting := range settings {
+		if value, ok := os.LookupEnv(name); ok {
+			*setting = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("PERIL_BROKER_EXTERNAL"); ok {
+		external, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid PERIL_BROKER_EXTERNAL: %v", err)
+		}
+		cfg.Broker.External = external
+	}
+	if value, ok := os.LookupEnv("PERIL_QUEUE_PREFETCH"); ok {
+		prefetch, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid PERIL_QUEUE_PREFETCH: %v", err)
+		}
+		cfg.Queues.Prefetch = prefetch
+	}
+	if value, ok := os.LookupEnv("PERIL_QUEUE_MESSAGE_TTL"); ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid PERIL_QUEUE_MESSAGE_TTL: %v", err)
+		}
+		cfg.Queues.MessageTTL = ttl
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) CommandChat(words []string) (routing.ChatMessage, error) {
+	if gs.isChatKicked() {
+		return routing.ChatMessage{}, errors.New("you have been kicked from the chat")
+	}
+
+	msg := routing.ChatMessage{
+		CurrentTime: time.Now(),
+		From:        gs.GetUsername(),
+	}
+
+	switch words[0] {
+	case "say":
+		if len(words) < 2 {
+			return routing.ChatMessage{}, errors.New("usage: say <message>")
+		}
+		msg.Channel = routing.ChatGlobal
+		msg.Message = strings.Join(words[1:], " ")
+	case "ally":
+		if len(words) < 2 {
+			return routing.ChatMessage{}, errors.New("usage: ally <message>")
+		}
+		msg.Channel = routing.ChatAlliance
+		msg.Message = strings.Join(words[1:], " ")
+	case "whisper":
+		if len(words) < 3 {
+			return routing.ChatMessage{}, errors.New("usage: whisper <player> <message>")
+		}
+		msg.Channel = routing.ChatDirect
+		msg.To = words[1]
+		msg.Message = strings.Join(words[2:], " ")
+	default:
+		return routing.ChatMessage{}, fmt.Errorf("error: %s is not a chat command", words[0])
+	}
+
+	return msg, nil
+}
+
+func (gs *GameState) HandleChat(msg routing.ChatMessage) bool {
+	username := gs.GetUsername()
+
+	switch msg.Channel {
+	case routing.ChatGlobal:
+		if msg.From == username && !msg.History {
+			return false
+		}
+	case routing.ChatAlliance:
+		if msg.From == username {
+			return false
+		}
+		if treaty, ok := gs.GetTreaty(msg.From); !ok || treaty != TreatyAlliance {
+			return false
+		}
+	case routing.ChatKick:
+		gs.kickFromChat()
+	}
+
+	fmt.Println()
+	fmt.Println(formatChat(msg))
+	return true
+}
+
+func formatChat(msg routing.ChatMessage) string {
+	timestamp := msg.CurrentTime.Format(time.Kitchen)
+	switch msg.Channel {
+	case routing.ChatDirect:
+		return fmt.Sprintf("[%s] %s whispers: %s", timestamp, msg.From, msg.Message)
+	case routing.ChatAlliance:
+		return fmt.Sprintf("[%s] (allies) %s: %s", timestamp, msg.From, msg.Message)
+	case routing.ChatSystem, routing.ChatKick:
+		return fmt.Sprintf("[%s] *** %s ***", timestamp, msg.Message)
+	}
+	if msg.History {
+		return fmt.Sprintf("[%s] (history) %s: %s", timestamp, msg.From, msg.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", timestamp, msg.From, msg.Message)
+}
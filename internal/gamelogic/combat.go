@@ -0,0 +1,179 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+type CombatResult struct {
+	AttackerPower      int
+	DefenderPower      int
+	AttackerCasualties []Unit
+	DefenderCasualties []Unit
+}
+
+// CombatResolver fights a war. Both sides of a war resolve it, so the
+// result may only depend on the units and the war's seed.
+type CombatResolver interface {
+	Resolve(seed int64, attackerUnits, defenderUnits []Unit) CombatResult
+}
+
+// PowerResolver is the classic rule set: the side with more summed power wins
+// and the loser loses every unit in the location. A draw wipes both sides.
+type PowerResolver struct{}
+
+func (PowerResolver) Resolve(seed int64, attackerUnits, defenderUnits []Unit) CombatResult {
+	result := CombatResult{
+		AttackerPower: unitsToPowerLevel(attackerUnits),
+		DefenderPower: unitsToPowerLevel(defenderUnits),
+	}
+
+	if result.AttackerPower >= result.DefenderPower {
+		result.DefenderCasualties = copyUnits(defenderUnits)
+	}
+	if result.DefenderPower >= result.AttackerPower {
+		result.AttackerCasualties = copyUnits(attackerUnits)
+	}
+
+	return result
+}
+
+const (
+	defaultDiceRounds    = 3
+	defaultDefenderBonus = 1
+	diceSides            = 6
+)
+
+// DiceResolver fights a war as a number of rounds of paired dice rolls.
+// Every roll is weighted by the unit's rank and by how well its rank matches
+// up against the opponent's. The loser of each pairing is a casualty, so wars
+// end with partial losses and are decided by the power that survived. The
+// dice are seeded by the war, the same war always ends the same way. The
+// zero value fights defaultDiceRounds rounds without a defender bonus.
+type DiceResolver struct {
+	Rounds        int
+	DefenderBonus int
+}
+
+func NewDiceResolver() DiceResolver {
+	return DiceResolver{
+		Rounds:        defaultDiceRounds,
+		DefenderBonus: defaultDefenderBonus,
+	}
+}
+
+// NewCombatResolver picks a rule set by name, power or dice.
+func NewCombatResolver(name string) (CombatResolver, error) {
+	switch name {
+	case "power":
+		return PowerResolver{}, nil
+	case "dice":
+		return NewDiceResolver(), nil
+	}
+	return nil, fmt.Errorf("unknown combat rules: %s", name)
+}
+
+func (dr DiceResolver) Resolve(seed int64, attackerUnits, defenderUnits []Unit) CombatResult {
+	rng := rand.New(rand.NewSource(seed))
+	rounds := dr.Rounds
+	if rounds <= 0 {
+		rounds = defaultDiceRounds
+	}
+
+	attackers := sortedByStrength(attackerUnits)
+	defenders := sortedByStrength(defenderUnits)
+	result := CombatResult{}
+
+	for round := 0; round < rounds; round++ {
+		if len(attackers) == 0 || len(defenders) == 0 {
+			break
+		}
+
+		pairs := min(len(attackers), len(defenders))
+		attackerLost := map[int]bool{}
+		defenderLost := map[int]bool{}
+
+		for i := 0; i < pairs; i++ {
+			attacker := attackers[i]
+			defender := defenders[i]
+
+			attackerRoll := roll(rng) + rankBonus(attacker.Rank) + matchupBonus(attacker.Rank, defender.Rank)
+			defenderRoll := roll(rng) + rankBonus(defender.Rank) + matchupBonus(defender.Rank, attacker.Rank) + dr.DefenderBonus
+
+			if attackerRoll > defenderRoll {
+				defenderLost[i] = true
+			} else {
+				attackerLost[i] = true
+			}
+		}
+
+		attackers, result.AttackerCasualties = removeLost(attackers, attackerLost, result.AttackerCasualties)
+		defenders, result.DefenderCasualties = removeLost(defenders, defenderLost, result.DefenderCasualties)
+	}
+
+	result.AttackerPower = unitsToPowerLevel(attackers)
+	result.DefenderPower = unitsToPowerLevel(defenders)
+	return result
+}
+
+func roll(rng *rand.Rand) int {
+	return rng.Intn(diceSides) + 1
+}
+
+func rankBonus(rank UnitRank) int {
+	switch rank {
+	case RankArtillery:
+		return 2
+	case RankCavalry:
+		return 1
+	}
+	return 0
+}
+
+// cavalry overruns artillery, artillery shells infantry, infantry holds
+// against cavalry
+func matchupBonus(rank, opponent UnitRank) int {
+	if rank == RankCavalry && opponent == RankArtillery {
+		return 2
+	}
+	if rank == RankArtillery && opponent == RankInfantry {
+		return 2
+	}
+	if rank == RankInfantry && opponent == RankCavalry {
+		return 1
+	}
+	return 0
+}
+
+// sortedByStrength orders units so that the strongest fight first and the
+// order doesn't depend on map iteration, which keeps seeded battles
+// reproducible.
+func sortedByStrength(units []Unit) []Unit {
+	sorted := copyUnits(units)
+	sort.Slice(sorted, func(i, j int) bool {
+		if rankBonus(sorted[i].Rank) != rankBonus(sorted[j].Rank) {
+			return rankBonus(sorted[i].Rank) > rankBonus(sorted[j].Rank)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+func removeLost(units []Unit, lost map[int]bool, casualties []Unit) ([]Unit, []Unit) {
+	survivors := []Unit{}
+	for i, unit := range units {
+		if lost[i] {
+			casualties = append(casualties, unit)
+			continue
+		}
+		survivors = append(survivors, unit)
+	}
+	return survivors, casualties
+}
+
+func copyUnits(units []Unit) []Unit {
+	copied := make([]Unit, len(units))
+	copy(copied, units)
+	return copied
+}
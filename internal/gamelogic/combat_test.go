@@ -0,0 +1,184 @@
+package gamelogic
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testUnits(location Location, ranks ...UnitRank) []Unit {
+	units := []Unit{}
+	for i, rank := range ranks {
+		units = append(units, Unit{ID: i + 1, Rank: rank, Location: location})
+	}
+	return units
+}
+
+func testPlayer(username string, units []Unit) *GameState {
+	gs := NewGameState(username)
+	for _, unit := range units {
+		gs.addUnit(unit)
+	}
+	return gs
+}
+
+func unitIDs(units []Unit) map[int]bool {
+	ids := map[int]bool{}
+	for _, unit := range units {
+		ids[unit.ID] = true
+	}
+	return ids
+}
+
+func TestDiceResolverIsReproducible(t *testing.T) {
+	attackers := testUnits("europe", RankInfantry, RankCavalry, RankArtillery, RankInfantry)
+	defenders := testUnits("europe", RankArtillery, RankInfantry, RankCavalry)
+
+	for seed := int64(0); seed < 50; seed++ {
+		first := NewDiceResolver().Resolve(seed, attackers, defenders)
+		second := NewDiceResolver().Resolve(seed, attackers, defenders)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("seed %v: got %+v, then %+v", seed, first, second)
+		}
+	}
+}
+
+func TestDiceResolverZeroValue(t *testing.T) {
+	attackers := testUnits("europe", RankInfantry, RankCavalry)
+	defenders := testUnits("europe", RankArtillery)
+
+	result := DiceResolver{}.Resolve(1, attackers, defenders)
+	lost := len(result.AttackerCasualties) + len(result.DefenderCasualties)
+	if lost == 0 {
+		t.Fatalf("the zero value fought no rounds: %+v", result)
+	}
+}
+
+// Both sides resolve a war on their own, they have to agree on the outcome
+// and each lose exactly their own casualties.
+func TestWarResolvedByBothSides(t *testing.T) {
+	attackerUnits := testUnits("europe", RankInfantry, RankCavalry, RankArtillery, RankInfantry)
+	defenderUnits := testUnits("europe", RankArtillery, RankInfantry, RankCavalry)
+
+	partial := false
+	for i := 0; i < 50; i++ {
+		// every attacker's name gives the war another seed
+		attacker := testPlayer(fmt.Sprintf("attacker%v", i), attackerUnits)
+		defender := testPlayer("defender", defenderUnits)
+		bystander := testPlayer("bystander", nil)
+		for _, gs := range []*GameState{attacker, defender, bystander} {
+			gs.SetCombatResolver(NewDiceResolver())
+		}
+
+		rw := defender.RecognizeWar(ArmyMove{Player: attacker.GetPlayerSnapAt("europe"), ToLocation: "europe"})
+		seed := rw.Seed
+		expected := NewDiceResolver().Resolve(seed, attackerUnits, defenderUnits)
+
+		attackerOutcome, attackerWinner, _ := attacker.HandleWar(rw)
+		defenderOutcome, defenderWinner, _ := defender.HandleWar(rw)
+		if outcome, _, _ := bystander.HandleWar(rw); outcome != WarOutcomeNotInvolved {
+			t.Fatalf("seed %v: bystander got outcome %v", seed, outcome)
+		}
+
+		if attackerWinner != defenderWinner {
+			t.Fatalf("seed %v: attacker says %q won, defender says %q", seed, attackerWinner, defenderWinner)
+		}
+		switch {
+		case attackerOutcome == WarOutcomeDraw && defenderOutcome != WarOutcomeDraw,
+			attackerOutcome == WarOutcomeYouWon && defenderOutcome != WarOutcomeOpponentWon,
+			attackerOutcome == WarOutcomeOpponentWon && defenderOutcome != WarOutcomeYouWon:
+			t.Fatalf("seed %v: attacker got %v, defender got %v", seed, attackerOutcome, defenderOutcome)
+		}
+
+		checkSurvivors(t, seed, attacker, attackerUnits, expected.AttackerCasualties)
+		checkSurvivors(t, seed, defender, defenderUnits, expected.DefenderCasualties)
+
+		// onlookers like the spectator see the same war
+		attackerLeft, defenderLeft := rw.Resolve(NewDiceResolver())
+		if len(attackerLeft) != len(attackerUnits)-len(expected.AttackerCasualties) ||
+			len(defenderLeft) != len(defenderUnits)-len(expected.DefenderCasualties) {
+			t.Fatalf("seed %v: onlookers see %v and %v units left, expected %+v", seed, len(attackerLeft), len(defenderLeft), expected)
+		}
+		if n := len(expected.DefenderCasualties); n > 0 && n < len(defenderUnits) {
+			partial = true
+		}
+	}
+
+	if !partial {
+		t.Fatal("no seed gave the defender partial losses")
+	}
+}
+
+func TestWarForgedByDefender(t *testing.T) {
+	attacker := testPlayer("attacker", testUnits("europe", RankInfantry, RankInfantry))
+	attacker.addUnit(Unit{ID: 3, Rank: RankArtillery, Location: "asia"})
+	defender := testPlayer("defender", testUnits("europe", RankArtillery))
+	move := ArmyMove{Player: attacker.GetPlayerSnapAt("europe"), ToLocation: "europe"}
+
+	// the defender can't pick the seed
+	rw := defender.RecognizeWar(move)
+	if !rw.SeedMatches() {
+		t.Fatal("the defender's recognition doesn't match the move")
+	}
+	rw.Seed++
+	if rw.SeedMatches() {
+		t.Fatal("a made up seed matches the move")
+	}
+	if outcome, _, _ := attacker.HandleWar(rw); outcome != WarOutcomeNoUnits {
+		t.Fatalf("the attacker fought a war with a made up seed: %v", outcome)
+	}
+	if len(attacker.getUnitsSnap()) != 3 {
+		t.Fatalf("the attacker lost units to a refused war: %+v", attacker.getUnitsSnap())
+	}
+
+	// nor list the attacker's units elsewhere as fighting
+	rw = defender.RecognizeWar(move)
+	artillery, _ := attacker.GetUnit(3)
+	artillery.Location = "europe"
+	rw.Attacker.Units[3] = artillery
+	if outcome, _, _ := attacker.HandleWar(rw); outcome != WarOutcomeOpponentWon {
+		t.Fatalf("the attacker's two infantry beat an artillery: %v", outcome)
+	}
+	if _, ok := attacker.GetUnit(3); !ok {
+		t.Fatal("the attacker lost a unit that wasn't in the war")
+	}
+	if len(attacker.getUnitsSnap()) != 1 {
+		t.Fatalf("the attacker kept units that lost the war: %+v", attacker.getUnitsSnap())
+	}
+}
+
+func checkSurvivors(t *testing.T, seed int64, gs *GameState, units, casualties []Unit) {
+	t.Helper()
+	lost := unitIDs(casualties)
+	for _, unit := range units {
+		_, alive := gs.GetUnit(unit.ID)
+		if alive == lost[unit.ID] {
+			t.Fatalf("seed %v: %s's unit %v alive: %v, a casualty: %v", seed, gs.GetUsername(), unit.ID, alive, lost[unit.ID])
+		}
+	}
+}
+
+func TestSpawnNeverReusesIDs(t *testing.T) {
+	gs := NewGameState("player")
+	for i := 0; i < 3; i++ {
+		err := gs.CommandSpawn([]string{"spawn", "europe", RankInfantry})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lost, _ := gs.GetUnit(2)
+	gs.removeUnits([]Unit{lost})
+	err := gs.CommandSpawn([]string{"spawn", "asia", RankCavalry})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := gs.GetUnit(2); ok {
+		t.Fatal("the lost unit's ID was handed out again")
+	}
+	unit, ok := gs.GetUnit(4)
+	if !ok || unit.Rank != RankCavalry {
+		t.Fatalf("expected the new cavalry to be unit 4, got %+v", gs.GetPlayerSnap().Units)
+	}
+}
@@ -0,0 +1,249 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrInvalidArgs    = errors.New("invalid command arguments")
+)
+
+// Arg is one argument of a command. A variadic arg takes every word left,
+// at least one unless it's optional too. Complete lists what the arg can
+// be, nil for free text.
+type Arg struct {
+	Name     string
+	Optional bool
+	Variadic bool
+	Complete func() []string
+}
+
+func (a Arg) String() string {
+	if a.Optional && a.Variadic {
+		return "[" + a.Name + "...]"
+	}
+	if a.Optional {
+		return "[" + a.Name + "]"
+	}
+	if a.Variadic {
+		return "<" + a.Name + "> <" + a.Name + ">..."
+	}
+	return "<" + a.Name + ">"
+}
+
+// Command is what a REPL can do. Run gets every word typed, the command's
+// canonical name first even when an alias was used.
+type Command struct {
+	Name    string
+	Aliases []string
+	Args    []Arg
+	Help    string
+	Example string
+	Run     func(words []string) error
+}
+
+func (c Command) Usage() string {
+	usage := []string{c.Name}
+	for _, arg := range c.Args {
+		usage = append(usage, arg.String())
+	}
+	return strings.Join(usage, " ")
+}
+
+func (c Command) validate(words []string) error {
+	args := words[1:]
+	min, max := 0, 0
+	for _, arg := range c.Args {
+		if !arg.Optional {
+			min++
+		}
+		max++
+		if arg.Variadic {
+			max = -1
+		}
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("%w: %s", ErrInvalidArgs, c.Usage())
+	}
+	return nil
+}
+
+// CommandRegistry dispatches the words typed in a REPL to their command,
+// and knows enough about them to print help and complete input.
+type CommandRegistry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{
+		commands: []*Command{},
+		byName:   map[string]*Command{},
+	}
+}
+
+// Register adds a command, help lists them in the order they came in.
+func (r *CommandRegistry) Register(cmd Command) {
+	c := &cmd
+	r.commands = append(r.commands, c)
+	r.byName[c.Name] = c
+	for _, alias := range c.Aliases {
+		r.byName[alias] = c
+	}
+}
+
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+// Run checks the arguments against the command's before running it.
+func (r *CommandRegistry) Run(words []string) error {
+	if len(words) == 0 {
+		return nil
+	}
+
+	c, ok := r.Lookup(words[0])
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, words[0])
+	}
+	err := c.validate(words)
+	if err != nil {
+		return err
+	}
+
+	words = append([]string{c.Name}, words[1:]...)
+	return c.Run(words)
+}
+
+// Names are the commands and their aliases, sorted.
+func (r *CommandRegistry) Names() []string {
+	names := []string{}
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Complete lists what can come after words, going by the command's args.
+func (r *CommandRegistry) Complete(words []string) []string {
+	if len(words) == 0 {
+		return r.Names()
+	}
+
+	c, ok := r.Lookup(words[0])
+	if !ok || len(c.Args) == 0 {
+		return []string{}
+	}
+
+	i := len(words) - 1
+	if i >= len(c.Args) {
+		if !c.Args[len(c.Args)-1].Variadic {
+			return []string{}
+		}
+		i = len(c.Args) - 1
+	}
+	if c.Args[i].Complete == nil {
+		return []string{}
+	}
+
+	candidates := []string{}
+	for _, candidate := range c.Args[i].Complete() {
+		// variadic args don't repeat themselves
+		if c.Args[i].Variadic && slices.Contains(words[1:], candidate) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+func (r *CommandRegistry) PrintHelp() {
+	fmt.Println("Possible commands:")
+	for _, c := range r.commands {
+		line := "* " + c.Usage()
+		if len(c.Aliases) > 0 {
+			line += fmt.Sprintf(" (or %s)", strings.Join(c.Aliases, ", "))
+		}
+		fmt.Println(line)
+		if c.Help != "" {
+			fmt.Printf("    %s\n", c.Help)
+		}
+		if c.Example != "" {
+			fmt.Println("    example:")
+			fmt.Printf("    %s\n", c.Example)
+		}
+	}
+}
+
+// CompleteLocations and the functions below are ready-made Arg.Complete
+// values.
+func CompleteLocations() []string {
+	locations := []string{}
+	for _, location := range GetLocations() {
+		locations = append(locations, string(location))
+	}
+	return locations
+}
+
+func CompleteRanks() []string {
+	ranks := []string{}
+	for _, rank := range GetRanks() {
+		ranks = append(ranks, string(rank))
+	}
+	return ranks
+}
+
+func CompleteTreaties() []string {
+	treaties := []string{}
+	for treaty := range getAllTreaties() {
+		treaties = append(treaties, string(treaty))
+	}
+	sort.Strings(treaties)
+	return treaties
+}
+
+func CompleteWords(words ...string) func() []string {
+	return func() []string {
+		return words
+	}
+}
+
+func (gs *GameState) CompleteUnitIDs() []string {
+	ids := []int{}
+	for _, unit := range gs.getUnitsSnap() {
+		ids = append(ids, unit.ID)
+	}
+	sort.Ints(ids)
+
+	completions := []string{}
+	for _, id := range ids {
+		completions = append(completions, strconv.Itoa(id))
+	}
+	return completions
+}
+
+// CompleteKnownPlayers are the players we've seen or have a treaty with.
+func (gs *GameState) CompleteKnownPlayers() []string {
+	players := map[string]bool{}
+	for username := range gs.GetLastKnownEnemies() {
+		players[username] = true
+	}
+	for username := range gs.GetTreatiesSnap() {
+		players[username] = true
+	}
+
+	usernames := []string{}
+	for username := range players {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
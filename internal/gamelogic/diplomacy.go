@@ -0,0 +1,140 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+)
+
+type TreatyKind string
+
+const (
+	TreatyAlliance      TreatyKind = "alliance"
+	TreatyNonAggression TreatyKind = "pact"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyPropose DiplomacyAction = "propose"
+	DiplomacyAccept  DiplomacyAction = "accept"
+	DiplomacyBreak   DiplomacyAction = "break"
+)
+
+type Diplomacy struct {
+	Action DiplomacyAction
+	Treaty TreatyKind
+	From   string
+	To     string
+}
+
+func (d Diplomacy) String() string {
+	switch d.Action {
+	case DiplomacyPropose:
+		return fmt.Sprintf("%s proposed a(n) %s to %s", d.From, d.Treaty, d.To)
+	case DiplomacyAccept:
+		return fmt.Sprintf("%s and %s signed a(n) %s", d.From, d.To, d.Treaty)
+	case DiplomacyBreak:
+		return fmt.Sprintf("%s broke their %s with %s", d.From, d.Treaty, d.To)
+	}
+	return fmt.Sprintf("%s sent an unknown diplomacy action to %s", d.From, d.To)
+}
+
+type DiplomacyOutcome int
+
+const (
+	DiplomacyOutcomeNotInvolved DiplomacyOutcome = iota
+	DiplomacyOutcomeProposed
+	DiplomacyOutcomeSigned
+	DiplomacyOutcomeBroken
+	DiplomacyOutcomeInvalid
+)
+
+func getAllTreaties() map[TreatyKind]struct{} {
+	return map[TreatyKind]struct{}{
+		TreatyAlliance:      {},
+		TreatyNonAggression: {},
+	}
+}
+
+func (gs *GameState) CommandDiplomacy(words []string) (Diplomacy, error) {
+	if len(words) < 2 {
+		return Diplomacy{}, errors.New("usage: propose <player> <alliance|pact>, accept <player>, break <player>")
+	}
+
+	action := DiplomacyAction(words[0])
+	other := words[1]
+	username := gs.GetUsername()
+	if other == username {
+		return Diplomacy{}, errors.New("error: you can not make treaties with yourself")
+	}
+
+	switch action {
+	case DiplomacyPropose:
+		if len(words) < 3 {
+			return Diplomacy{}, errors.New("usage: propose <player> <alliance|pact>")
+		}
+		treaty := TreatyKind(words[2])
+		if _, ok := getAllTreaties()[treaty]; !ok {
+			return Diplomacy{}, fmt.Errorf("error: %s is not a valid treaty", treaty)
+		}
+		gs.setProposal(other, treaty)
+		fmt.Printf("Proposed a(n) %s to %s\n", treaty, other)
+		return Diplomacy{Action: action, Treaty: treaty, From: username, To: other}, nil
+
+	case DiplomacyAccept:
+		treaty, ok := gs.takeOffer(other)
+		if !ok {
+			return Diplomacy{}, fmt.Errorf("error: %s has not proposed a treaty to you", other)
+		}
+		gs.setTreaty(other, treaty)
+		fmt.Printf("Signed a(n) %s with %s\n", treaty, other)
+		return Diplomacy{Action: action, Treaty: treaty, From: username, To: other}, nil
+
+	case DiplomacyBreak:
+		treaty, ok := gs.GetTreaty(other)
+		if !ok {
+			return Diplomacy{}, fmt.Errorf("error: you have no treaty with %s", other)
+		}
+		gs.removeTreaty(other)
+		fmt.Printf("Broke your %s with %s\n", treaty, other)
+		return Diplomacy{Action: action, Treaty: treaty, From: username, To: other}, nil
+	}
+
+	return Diplomacy{}, fmt.Errorf("error: %s is not a valid diplomacy action", action)
+}
+
+func (gs *GameState) HandleDiplomacy(d Diplomacy) DiplomacyOutcome {
+	username := gs.GetUsername()
+	if d.To != username {
+		return DiplomacyOutcomeNotInvolved
+	}
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Diplomacy ====")
+
+	switch d.Action {
+	case DiplomacyPropose:
+		gs.setOffer(d.From, d.Treaty)
+		fmt.Printf("%s proposes a(n) %s. Type \"accept %s\" to sign it.\n", d.From, d.Treaty, d.From)
+		return DiplomacyOutcomeProposed
+
+	case DiplomacyAccept:
+		treaty, ok := gs.takeProposal(d.From)
+		if !ok || treaty != d.Treaty {
+			fmt.Printf("%s accepted a(n) %s you never proposed.\n", d.From, d.Treaty)
+			return DiplomacyOutcomeInvalid
+		}
+		gs.setTreaty(d.From, treaty)
+		fmt.Printf("%s accepted your %s!\n", d.From, treaty)
+		return DiplomacyOutcomeSigned
+
+	case DiplomacyBreak:
+		gs.removeTreaty(d.From)
+		fmt.Printf("%s broke their %s with you!\n", d.From, d.Treaty)
+		return DiplomacyOutcomeBroken
+	}
+
+	fmt.Printf("Unknown diplomacy action from %s: %s\n", d.From, d.Action)
+	return DiplomacyOutcomeInvalid
+}
@@ -0,0 +1,155 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sighting is the last time an enemy's units were seen in a location. It
+// goes stale as soon as it's made, the units may have moved on since.
+type Sighting struct {
+	Username string
+	Location Location
+	Units    []Unit
+	SeenAt   time.Time
+}
+
+// getVisibleLocations are the player's territories and their neighbours.
+// Moves elsewhere still reach the client, they're just not looked at: the
+// fog only hides what the game shows. Every move goes out on the topic
+// exchange, so a modified client or anyone bound to it sees them all.
+func (gs *GameState) getVisibleLocations() map[Location]bool {
+	adjacent := getAdjacentLocations()
+	visible := map[Location]bool{}
+	for _, unit := range gs.getUnitsSnap() {
+		visible[unit.Location] = true
+		for _, neighbour := range adjacent[unit.Location] {
+			visible[neighbour] = true
+		}
+	}
+	return visible
+}
+
+func (gs *GameState) canSee(location Location) bool {
+	return gs.getVisibleLocations()[location]
+}
+
+// recordSighting replaces what we knew of username's units in location.
+// The units seen there are no longer wherever they were seen before.
+func (gs *GameState) recordSighting(username string, location Location, units []Unit) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	sightings, ok := gs.sightings[username]
+	if !ok {
+		sightings = map[Location]Sighting{}
+		gs.sightings[username] = sightings
+	}
+
+	seen := map[int]bool{}
+	for _, unit := range units {
+		seen[unit.ID] = true
+	}
+	for other, sighting := range sightings {
+		remaining := []Unit{}
+		for _, unit := range sighting.Units {
+			if !seen[unit.ID] {
+				remaining = append(remaining, unit)
+			}
+		}
+		sighting.Units = remaining
+		sightings[other] = sighting
+		if len(remaining) == 0 {
+			delete(sightings, other)
+		}
+	}
+
+	if len(units) == 0 {
+		delete(sightings, location)
+		return
+	}
+	sightings[location] = Sighting{
+		Username: username,
+		Location: location,
+		Units:    copyUnits(units),
+		SeenAt:   time.Now(),
+	}
+}
+
+func (gs *GameState) clearSightings() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.sightings = map[string]map[Location]Sighting{}
+}
+
+// GetSightingsSnap returns the last known enemy positions, oldest first.
+func (gs *GameState) GetSightingsSnap() []Sighting {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	snap := []Sighting{}
+	for _, sightings := range gs.sightings {
+		for _, sighting := range sightings {
+			sighting.Units = copyUnits(sighting.Units)
+			snap = append(snap, sighting)
+		}
+	}
+	sort.Slice(snap, func(i, j int) bool { return snap[i].SeenAt.Before(snap[j].SeenAt) })
+	return snap
+}
+
+// GetLastKnownEnemies puts the sightings back together into players, as
+// far as we know them.
+func (gs *GameState) GetLastKnownEnemies() map[string]Player {
+	enemies := map[string]Player{}
+	for _, sighting := range gs.GetSightingsSnap() {
+		enemy, ok := enemies[sighting.Username]
+		if !ok {
+			enemy = Player{Username: sighting.Username, Units: map[int]Unit{}}
+			enemies[sighting.Username] = enemy
+		}
+		for _, unit := range sighting.Units {
+			enemy.Units[unit.ID] = unit
+		}
+	}
+	return enemies
+}
+
+func printSightings(sightings []Sighting) {
+	if len(sightings) == 0 {
+		fmt.Println("You haven't seen any enemy units.")
+		return
+	}
+
+	fmt.Println("Last known enemy positions:")
+	for _, sighting := range sightings {
+		ranks := []string{}
+		for _, unit := range sighting.Units {
+			ranks = append(ranks, string(unit.Rank))
+		}
+		sort.Strings(ranks)
+		fmt.Printf(
+			"* %s: %v unit(s) in %s (%s), seen %v ago\n",
+			sighting.Username,
+			len(sighting.Units),
+			sighting.Location,
+			strings.Join(ranks, ", "),
+			time.Since(sighting.SeenAt).Round(time.Second),
+		)
+	}
+}
+
+func survivingUnits(units, casualties []Unit) []Unit {
+	lost := map[int]bool{}
+	for _, unit := range casualties {
+		lost[unit.ID] = true
+	}
+	survivors := []Unit{}
+	for _, unit := range units {
+		if !lost[unit.ID] {
+			survivors = append(survivors, unit)
+		}
+	}
+	return survivors
+}
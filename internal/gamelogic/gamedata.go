@@ -1,5 +1,7 @@
 package gamelogic
 
+import "sort"
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -25,28 +27,95 @@ type ArmyMove struct {
 	ToLocation Location
 }
 
+// RecognitionOfWar is published by the defender. Both sides resolve the
+// war from it, and Seed, which comes from the attacker's move, makes their
+// dice roll the same numbers.
 type RecognitionOfWar struct {
 	Attacker Player
 	Defender Player
+	Seed     int64
 }
 
 type Location string
 
+// The classic map and ranks, unless SetMap replaced them.
+var (
+	adjacentLocations = DefaultAdjacentLocations()
+	rankPowers        = DefaultRankPowers()
+)
+
+// DefaultAdjacentLocations is who borders whom on the classic map.
+func DefaultAdjacentLocations() map[Location][]Location {
+	return map[Location][]Location{
+		"americas":   {"europe", "africa", "asia", "antarctica"},
+		"europe":     {"americas", "africa", "asia"},
+		"africa":     {"americas", "europe", "asia", "antarctica"},
+		"asia":       {"americas", "europe", "africa", "australia"},
+		"australia":  {"asia", "antarctica"},
+		"antarctica": {"americas", "africa", "australia"},
+	}
+}
+
+// DefaultRankPowers is what each classic rank weighs in a war.
+func DefaultRankPowers() map[UnitRank]int {
+	return map[UnitRank]int{
+		RankInfantry:  1,
+		RankCavalry:   5,
+		RankArtillery: 10,
+	}
+}
+
+// SetMap replaces the locations, their borders and the unit ranks. It
+// must be called before any game state is created, every player of a game
+// needs the same map.
+func SetMap(adjacent map[Location][]Location, powers map[UnitRank]int) {
+	adjacentLocations = adjacent
+	rankPowers = powers
+}
+
 func getAllRanks() map[UnitRank]struct{} {
-	return map[UnitRank]struct{}{
-		RankInfantry:  {},
-		RankCavalry:   {},
-		RankArtillery: {},
+	ranks := map[UnitRank]struct{}{}
+	for rank := range rankPowers {
+		ranks[rank] = struct{}{}
 	}
+	return ranks
 }
 
 func getAllLocations() map[Location]struct{} {
-	return map[Location]struct{}{
-		"americas":   {},
-		"europe":     {},
-		"africa":     {},
-		"asia":       {},
-		"australia":  {},
-		"antarctica": {},
+	locations := map[Location]struct{}{}
+	for location := range adjacentLocations {
+		locations[location] = struct{}{}
 	}
+	return locations
+}
+
+// getAdjacentLocations is who borders whom, it decides what a player can
+// see from the territories they hold.
+func getAdjacentLocations() map[Location][]Location {
+	return adjacentLocations
+}
+
+func GetLocations() []Location {
+	locations := []Location{}
+	for location := range getAllLocations() {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i] < locations[j] })
+	return locations
+}
+
+func GetRanks() []UnitRank {
+	ranks := []UnitRank{}
+	for rank := range getAllRanks() {
+		ranks = append(ranks, rank)
+	}
+	sort.Slice(ranks, func(i, j int) bool { return ranks[i] < ranks[j] })
+	return ranks
+}
+
+// GetRanksByPower lists the ranks from the heaviest to the lightest.
+func GetRanksByPower() []UnitRank {
+	ranks := GetRanks()
+	sort.SliceStable(ranks, func(i, j int) bool { return rankPowers[ranks[i]] > rankPowers[ranks[j]] })
+	return ranks
 }
@@ -6,26 +6,41 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"slices"
 	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-func PrintClientHelp() {
-	fmt.Println("Possible commands:")
-	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
-	fmt.Println("    example:")
-	fmt.Println("    move asia 1")
-	fmt.Println("* spawn <location> <rank>")
-	fmt.Println("    example:")
-	fmt.Println("    spawn europe infantry")
-	fmt.Println("* status")
-	fmt.Println("* spam <n>")
-	fmt.Println("    example:")
-	fmt.Println("    spam 5")
-	fmt.Println("* quit")
-	fmt.Println("* help")
+func ClientWelcome(rooms []routing.RoomInfo) (string, string, error) {
+	username, err := AskUsername()
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(rooms) == 0 {
+		return "", "", errors.New("there are no open game rooms. goodbye")
+	}
+	fmt.Println("Open game rooms:")
+	for _, room := range rooms {
+		fmt.Printf("* %s (%s, %v players)\n", room.GameID, room.Phase, room.Players)
+	}
+	fmt.Println("Please choose a room:")
+	words := GetInput()
+	if len(words) == 0 {
+		return "", "", errors.New("you must choose a room. goodbye")
+	}
+	gameID := words[0]
+	if !slices.ContainsFunc(rooms, func(room routing.RoomInfo) bool { return room.GameID == gameID }) {
+		return "", "", fmt.Errorf("room %s does not exist. goodbye", gameID)
+	}
+	fmt.Printf("Joined room %s\n", gameID)
+	return username, gameID, nil
 }
 
-func ClientWelcome() (string, error) {
+// AskUsername is the first half of ClientWelcome, for players who don't
+// pick a room themselves.
+func AskUsername() (string, error) {
 	fmt.Println("Welcome to the Peril client!")
 	fmt.Println("Please enter your username:")
 	words := GetInput()
@@ -34,16 +49,22 @@ func ClientWelcome() (string, error) {
 	}
 	username := words[0]
 	fmt.Printf("Welcome, %s!\n", username)
-	PrintClientHelp()
 	return username, nil
 }
 
-func PrintServerHelp() {
-	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
-	fmt.Println("* resume")
-	fmt.Println("* quit")
-	fmt.Println("* help")
+func GetPassword() (string, error) {
+	fmt.Println("Please enter your password:")
+	words := GetInput()
+	if len(words) == 0 {
+		return "", errors.New("you must enter a password. goodbye")
+	}
+	return words[0], nil
+}
+
+func Confirm(question string) bool {
+	fmt.Printf("%s (y/n)\n", question)
+	words := GetInput()
+	return len(words) > 0 && strings.ToLower(words[0]) == "y"
 }
 
 func GetInput() []string {
@@ -77,16 +98,31 @@ func PrintQuit() {
 }
 
 func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
+	if gs.isHeld() {
+		fmt.Println("The server paused you.")
+		return
+	} else if gs.isPaused() {
 		fmt.Println("The game is paused.")
 		return
 	} else {
 		fmt.Println("The game is not paused.")
 	}
 
+	if phase := gs.getPhase(); phase != "" {
+		fmt.Printf("The game is in the %s phase.\n", phase)
+	}
+
 	p := gs.GetPlayerSnap()
 	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
 	for _, unit := range p.Units {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
+
+	for username, treaty := range gs.GetTreatiesSnap() {
+		fmt.Printf("You have a(n) %s with %s.\n", treaty, username)
+	}
+
+	printOpponents(gs.GetOpponents())
+
+	printSightings(gs.GetSightingsSnap())
 }
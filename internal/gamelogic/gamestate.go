@@ -2,12 +2,26 @@ package gamelogic
 
 import (
 	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 type GameState struct {
-	Player Player
-	Paused bool
-	mu     *sync.RWMutex
+	Player    Player
+	Paused    bool
+	resolver  CombatResolver
+	lastUnit  int
+	treaties  map[string]TreatyKind
+	proposals map[string]TreatyKind
+	offers    map[string]TreatyKind
+	kicked    bool
+	held      bool // paused by the server on their own
+	removed   bool // kicked from the game by the server
+	phase     routing.GamePhase
+	sightings map[string]map[Location]Sighting
+	players   []string
+	online    map[string]bool
+	mu        *sync.RWMutex
 }
 
 func NewGameState(username string) *GameState {
@@ -16,11 +30,30 @@ func NewGameState(username string) *GameState {
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:    false,
+		resolver:  PowerResolver{},
+		treaties:  map[string]TreatyKind{},
+		proposals: map[string]TreatyKind{},
+		offers:    map[string]TreatyKind{},
+		sightings: map[string]map[Location]Sighting{},
+		players:   []string{},
+		online:    map[string]bool{},
+		mu:        &sync.RWMutex{},
 	}
 }
 
+func (gs *GameState) SetCombatResolver(resolver CombatResolver) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.resolver = resolver
+}
+
+func (gs *GameState) getCombatResolver() CombatResolver {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.resolver
+}
+
 func (gs *GameState) resumeGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -36,7 +69,86 @@ func (gs *GameState) pauseGame() {
 func (gs *GameState) isPaused() bool {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
-	return gs.Paused
+	return gs.Paused || gs.held
+}
+
+func (gs *GameState) setHeld(held bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.held = held
+}
+
+func (gs *GameState) isHeld() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.held
+}
+
+func (gs *GameState) remove() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.removed = true
+}
+
+func (gs *GameState) isRemoved() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.removed
+}
+
+func (gs *GameState) setPhase(phase routing.GamePhase) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.phase = phase
+}
+
+func (gs *GameState) getPhase() routing.GamePhase {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.phase
+}
+
+// isPlayable is false while a lifecycle server holds the game in the
+// lobby or has ended it, and once it removed the player. Without a server
+// there is no phase and the game is always on.
+func (gs *GameState) isPlayable() bool {
+	if gs.isRemoved() {
+		return false
+	}
+	phase := gs.getPhase()
+	return phase != routing.GamePhaseLobby && phase != routing.GamePhaseOver
+}
+
+func (gs *GameState) clearUnits() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Units = map[int]Unit{}
+}
+
+func (gs *GameState) kickFromChat() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.kicked = true
+}
+
+func (gs *GameState) isChatKicked() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.kicked
+}
+
+// nextUnitID never hands out an ID twice, even once units in between were
+// lost.
+func (gs *GameState) nextUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.lastUnit++
+	for {
+		if _, ok := gs.Player.Units[gs.lastUnit]; !ok {
+			return gs.lastUnit
+		}
+		gs.lastUnit++
+	}
 }
 
 func (gs *GameState) addUnit(u Unit) {
@@ -45,13 +157,11 @@ func (gs *GameState) addUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+func (gs *GameState) removeUnits(units []Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
-		}
+	for _, unit := range units {
+		delete(gs.Player.Units, unit.ID)
 	}
 }
 
@@ -94,3 +204,79 @@ func (gs *GameState) GetPlayerSnap() Player {
 		Units:    Units,
 	}
 }
+
+// GetPlayerSnapAt is the part of the player that others may see: only the
+// units in location.
+func (gs *GameState) GetPlayerSnapAt(location Location) Player {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	Units := map[int]Unit{}
+	for k, v := range gs.Player.Units {
+		if v.Location == location {
+			Units[k] = v
+		}
+	}
+	return Player{
+		Username: gs.Player.Username,
+		Units:    Units,
+	}
+}
+
+func (gs *GameState) GetTreaty(username string) (TreatyKind, bool) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	treaty, ok := gs.treaties[username]
+	return treaty, ok
+}
+
+func (gs *GameState) GetTreatiesSnap() map[string]TreatyKind {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	treaties := map[string]TreatyKind{}
+	for k, v := range gs.treaties {
+		treaties[k] = v
+	}
+	return treaties
+}
+
+func (gs *GameState) setTreaty(username string, treaty TreatyKind) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.treaties[username] = treaty
+}
+
+func (gs *GameState) removeTreaty(username string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	delete(gs.treaties, username)
+	delete(gs.proposals, username)
+	delete(gs.offers, username)
+}
+
+func (gs *GameState) setProposal(username string, treaty TreatyKind) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.proposals[username] = treaty
+}
+
+func (gs *GameState) takeProposal(username string) (TreatyKind, bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	treaty, ok := gs.proposals[username]
+	delete(gs.proposals, username)
+	return treaty, ok
+}
+
+func (gs *GameState) setOffer(username string, treaty TreatyKind) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.offers[username] = treaty
+}
+
+func (gs *GameState) takeOffer(username string) (TreatyKind, bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	treaty, ok := gs.offers[username]
+	delete(gs.offers, username)
+	return treaty, ok
+}
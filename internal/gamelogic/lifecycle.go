@@ -0,0 +1,180 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const territoryScore = 10
+
+type VictoryConditions struct {
+	Territories int
+	TimeLimit   time.Duration
+}
+
+func (vc VictoryConditions) String() string {
+	conditions := []string{"eliminate all opponents"}
+	if vc.Territories > 0 {
+		conditions = append(conditions, fmt.Sprintf("control %v territories", vc.Territories))
+	}
+	if vc.TimeLimit > 0 {
+		conditions = append(conditions, fmt.Sprintf("highest score after %v", vc.TimeLimit))
+	}
+	return strings.Join(conditions, ", ")
+}
+
+// GetControlledTerritories returns the locations where the player has units
+// and nobody else does.
+func GetControlledTerritories(player Player, players map[string]Player) []Location {
+	contested := map[Location]bool{}
+	for username, other := range players {
+		if username == player.Username {
+			continue
+		}
+		for _, unit := range other.Units {
+			contested[unit.Location] = true
+		}
+	}
+
+	controlled := []Location{}
+	for _, location := range GetLocations() {
+		if contested[location] {
+			continue
+		}
+		for _, unit := range player.Units {
+			if unit.Location == location {
+				controlled = append(controlled, location)
+				break
+			}
+		}
+	}
+	return controlled
+}
+
+func GetStandings(players map[string]Player) []routing.Standing {
+	standings := []routing.Standing{}
+	for _, player := range players {
+		units := []Unit{}
+		for _, unit := range player.Units {
+			units = append(units, unit)
+		}
+		territories := len(GetControlledTerritories(player, players))
+		standings = append(standings, routing.Standing{
+			Username:    player.Username,
+			Territories: territories,
+			Units:       len(units),
+			Score:       unitsToPowerLevel(units) + territories*territoryScore,
+		})
+	}
+
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
+
+// CheckVictory decides whether the game is over. fielded holds the players
+// that have had units at some point, so that someone who hasn't spawned
+// yet doesn't count as eliminated.
+func CheckVictory(
+	conditions VictoryConditions,
+	players map[string]Player,
+	fielded map[string]bool,
+	elapsed time.Duration,
+) (winner string, reason string, over bool) {
+	if conditions.Territories > 0 {
+		for _, standing := range GetStandings(players) {
+			if standing.Territories >= conditions.Territories {
+				return standing.Username, fmt.Sprintf("controls %v territories", standing.Territories), true
+			}
+		}
+	}
+
+	if len(fielded) >= 2 {
+		alive := []string{}
+		for username := range fielded {
+			if len(players[username].Units) > 0 {
+				alive = append(alive, username)
+			}
+		}
+		if len(alive) == 1 {
+			return alive[0], "eliminated all opponents", true
+		}
+	}
+
+	if conditions.TimeLimit > 0 && elapsed >= conditions.TimeLimit {
+		standings := GetStandings(players)
+		if len(standings) == 0 {
+			return "", "time limit reached with no players", true
+		}
+		if len(standings) > 1 && standings[0].Score == standings[1].Score {
+			return "", "time limit reached with a tied score", true
+		}
+		return standings[0].Username, "highest score when the time limit was reached", true
+	}
+
+	return "", "", false
+}
+
+func (gs *GameState) HandleLifecycle(lc routing.GameLifecycle) {
+	gs.setPlayers(lc.Players)
+	if lc.Combat != "" {
+		resolver, err := NewCombatResolver(lc.Combat)
+		if err != nil {
+			fmt.Printf("The server plays by %s combat, which you don't know: %v\n", lc.Combat, err)
+		} else {
+			gs.SetCombatResolver(resolver)
+		}
+	}
+	previous := gs.getPhase()
+	if previous == lc.Phase {
+		return
+	}
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+
+	switch lc.Phase {
+	case routing.GamePhaseLobby:
+		fmt.Println("==== Lobby ====")
+		fmt.Printf("Waiting for the server to start the game. Players: %s\n", strings.Join(lc.Players, ", "))
+	case routing.GamePhaseStarted:
+		fmt.Println("==== Game Started ====")
+		fmt.Printf("Players: %s\n", strings.Join(lc.Players, ", "))
+		conditions := VictoryConditions{Territories: lc.Territories, TimeLimit: lc.TimeLimit}
+		fmt.Printf("Win by: %s\n", conditions)
+		gs.clearUnits()
+		gs.clearSightings()
+	case routing.GamePhaseOver:
+		fmt.Println("==== Game Over ====")
+		if lc.Winner == "" {
+			fmt.Printf("Nobody won: %s\n", lc.Reason)
+		} else {
+			fmt.Printf("%s won: %s\n", lc.Winner, lc.Reason)
+		}
+		PrintStandings(lc.Standings)
+	}
+
+	gs.setPhase(lc.Phase)
+}
+
+func PrintStandings(standings []routing.Standing) {
+	fmt.Println("Standings:")
+	for i, standing := range standings {
+		fmt.Printf(
+			"%v. %s: score %v, %v territories, %v units\n",
+			i+1,
+			standing.Username,
+			standing.Score,
+			standing.Territories,
+			standing.Units,
+		)
+	}
+}
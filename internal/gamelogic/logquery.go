@@ -0,0 +1,142 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// LogFilter keeps the logs matching every field that is set. A player
+// matches the logs they wrote and the ones they took part in.
+type LogFilter struct {
+	Username string
+	Event    routing.LogEvent
+	GameID   string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f LogFilter) Match(gamelog routing.GameLog) bool {
+	if f.Username != "" && gamelog.Username != f.Username && !slices.Contains(gamelog.Participants, f.Username) {
+		return false
+	}
+	if f.Event != "" && gamelog.GetEvent() != f.Event {
+		return false
+	}
+	if f.GameID != "" && gamelog.GameID != f.GameID {
+		return false
+	}
+	if !f.Since.IsZero() && gamelog.CurrentTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && gamelog.CurrentTime.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// ReadLogs returns the logs in path and its rotated backups that match the
+// filter, oldest first.
+func ReadLogs(path string, filter LogFilter) ([]routing.GameLog, error) {
+	paths := []string{}
+	for i := 1; ; i++ {
+		backup := backupLogPath(path, i)
+		if _, err := os.Stat(backup); err != nil {
+			break
+		}
+		paths = append([]string{backup}, paths...)
+	}
+	paths = append(paths, path)
+
+	logs := []routing.GameLog{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not open logs file: %v", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var gamelog routing.GameLog
+			if json.Unmarshal(scanner.Bytes(), &gamelog) != nil {
+				continue
+			}
+			if filter.Match(gamelog) {
+				logs = append(logs, gamelog)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read logs file %s: %v", p, err)
+		}
+	}
+	return logs, nil
+}
+
+func ExportLogs(w io.Writer, logs []routing.GameLog, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(logs)
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"time", "game", "event", "username", "location", "participants", "outcome", "message"})
+		if err != nil {
+			return err
+		}
+		for _, gamelog := range logs {
+			err := writer.Write([]string{
+				gamelog.CurrentTime.Format(time.RFC3339),
+				gamelog.GameID,
+				string(gamelog.GetEvent()),
+				gamelog.Username,
+				gamelog.Location,
+				strings.Join(gamelog.Participants, ";"),
+				gamelog.Outcome,
+				gamelog.Message,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown export format: %s", format)
+}
+
+func PrintLogs(logs []routing.GameLog) {
+	if len(logs) == 0 {
+		fmt.Println("No logs found.")
+		return
+	}
+	for _, gamelog := range logs {
+		fmt.Println(FormatLog(gamelog))
+	}
+}
+
+func FormatLog(gamelog routing.GameLog) string {
+	return fmt.Sprintf(
+		"%v [%s/%s] %v: %v",
+		gamelog.CurrentTime.Format(time.RFC3339),
+		gamelog.GameID,
+		gamelog.GetEvent(),
+		gamelog.Username,
+		gamelog.Message,
+	)
+}
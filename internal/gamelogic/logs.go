@@ -1,32 +1,179 @@
 package gamelogic
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-const logsFile = "game.log"
+const logsFile = "game.jsonl"
 
-const writeToDiskSleep = 1 * time.Second
+func GetLogsFile() string {
+	return logsFile
+}
 
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
-	time.Sleep(writeToDiskSleep)
+// LogWriter appends game logs as JSON lines. Once the file grows past
+// maxSize it's renamed to path.1, the older backups shift up one number
+// and the oldest above maxBackups is deleted.
+type LogWriter struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	mu         *sync.Mutex
+}
 
-	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("could not open logs file: %v", err)
+func NewLogWriter(path string, maxSize int64, maxBackups int) *LogWriter {
+	return &LogWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		mu:         &sync.Mutex{},
+	}
+}
+
+func (lw *LogWriter) Write(gamelog routing.GameLog) error {
+	return lw.WriteBatch([]routing.GameLog{gamelog})
+}
+
+// WriteBatch appends the logs with as few writes as rotation allows and
+// fsyncs once, the logs are on disk when it returns.
+func (lw *LogWriter) WriteBatch(gamelogs []routing.GameLog) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if lw.file == nil {
+		err := lw.open()
+		if err != nil {
+			return fmt.Errorf("could not open logs file: %v", err)
+		}
 	}
-	defer f.Close()
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
-	_, err = f.WriteString(str)
+	buffer := []byte{}
+	for _, gamelog := range gamelogs {
+		line, err := json.Marshal(gamelog)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		pending := lw.size + int64(len(buffer))
+		if pending > 0 && pending+int64(len(line)) > lw.maxSize {
+			err = lw.flush(buffer)
+			if err != nil {
+				return err
+			}
+			buffer = buffer[:0]
+
+			err = lw.rotate()
+			if err != nil {
+				return fmt.Errorf("could not rotate logs file: %v", err)
+			}
+			err = lw.open()
+			if err != nil {
+				return fmt.Errorf("could not open logs file: %v", err)
+			}
+		}
+		buffer = append(buffer, line...)
+	}
+
+	return lw.flush(buffer)
+}
+
+func (lw *LogWriter) flush(buffer []byte) error {
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	n, err := lw.file.Write(buffer)
+	lw.size += int64(n)
 	if err != nil {
 		return fmt.Errorf("could not write to logs file: %v", err)
 	}
+
+	err = lw.file.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync logs file: %v", err)
+	}
 	return nil
 }
+
+func (lw *LogWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.file == nil {
+		return nil
+	}
+	err := lw.file.Close()
+	lw.file = nil
+	return err
+}
+
+func (lw *LogWriter) open() error {
+	f, err := os.OpenFile(lw.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lw.file = f
+	lw.size = info.Size()
+	return nil
+}
+
+func (lw *LogWriter) rotate() error {
+	err := lw.file.Close()
+	lw.file = nil
+	if err != nil {
+		return err
+	}
+
+	os.Remove(backupLogPath(lw.path, lw.maxBackups))
+	for i := lw.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(backupLogPath(lw.path, i), backupLogPath(lw.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if lw.maxBackups < 1 {
+		return os.Remove(lw.path)
+	}
+	return os.Rename(lw.path, backupLogPath(lw.path, 1))
+}
+
+func backupLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// WarLog is the player's report of a war they fought. Both sides report
+// it, the server only counts wars whose reports agree.
+func (gs *GameState) WarLog(gameID string, rw RecognitionOfWar, outcome WarOutcome, winner, loser string) routing.GameLog {
+	gamelog := routing.GameLog{
+		CurrentTime:  time.Now(),
+		Username:     gs.GetUsername(),
+		Event:        routing.LogEventWar,
+		GameID:       gameID,
+		Location:     string(rw.Location()),
+		Participants: []string{rw.Attacker.Username, rw.Defender.Username},
+		Seed:         rw.Seed,
+	}
+
+	if outcome == WarOutcomeDraw {
+		gamelog.Message = fmt.Sprintf("A war between %s and %s resulted in a draw", winner, loser)
+		gamelog.Outcome = "draw"
+		return gamelog
+	}
+
+	gamelog.Message = fmt.Sprintf("%s won a war against %s", winner, loser)
+	gamelog.Outcome = fmt.Sprintf("%s won", winner)
+	gamelog.Winner = winner
+	return gamelog
+}
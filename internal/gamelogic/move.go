@@ -20,6 +20,11 @@ func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
 
 	fmt.Println()
 	fmt.Println("==== Move Detected ====")
+	if player.Username != move.Player.Username && !gs.canSee(move.ToLocation) {
+		fmt.Printf("%s moved units somewhere you can't see.\n", move.Player.Username)
+		return MoveOutComeSafe
+	}
+
 	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
 	for _, unit := range move.Units {
 		fmt.Printf("* %v\n", unit.Rank)
@@ -29,7 +34,17 @@ func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
 		return MoveOutcomeSamePlayer
 	}
 
+	units := []Unit{}
+	for _, unit := range move.Player.Units {
+		units = append(units, unit)
+	}
+	gs.recordSighting(move.Player.Username, move.ToLocation, units)
+
 	overlappingLocation := getOverlappingLocation(player, move.Player)
+	if treaty, ok := gs.GetTreaty(move.Player.Username); ok && overlappingLocation != "" {
+		fmt.Printf("You share %s with %s, but your %s keeps the peace.\n", overlappingLocation, move.Player.Username, treaty)
+		return MoveOutComeSafe
+	}
 	if overlappingLocation != "" {
 		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
 		return MoveOutcomeMakeWar
@@ -53,6 +68,9 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	if gs.isPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
 	}
+	if !gs.isPlayable() {
+		return ArmyMove{}, errors.New("the game is not running, you can not move units")
+	}
 	if len(words) < 3 {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
 	}
@@ -85,7 +103,7 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	mv := ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
-		Player:     gs.GetPlayerSnap(),
+		Player:     gs.GetPlayerSnapAt(newLocation),
 	}
 	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
 	return mv, nil
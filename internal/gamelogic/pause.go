@@ -17,3 +17,44 @@ func (gs *GameState) HandlePause(ps routing.PlayingState) {
 		gs.resumeGame()
 	}
 }
+
+// HandlePlayerControl applies what the server did to this player alone,
+// reporting whether it was about them.
+func (gs *GameState) HandlePlayerControl(pc routing.PlayerControl) bool {
+	if pc.Username != gs.GetUsername() {
+		return false
+	}
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	switch pc.Action {
+	case routing.PlayerPause:
+		fmt.Println("==== The Server Paused You ====")
+		gs.setHeld(true)
+	case routing.PlayerResume:
+		fmt.Println("==== The Server Resumed You ====")
+		gs.setHeld(false)
+	case routing.PlayerKick:
+		fmt.Println("==== Kicked From the Game ====")
+		gs.remove()
+		gs.clearUnits()
+	}
+	if pc.Reason != "" {
+		fmt.Printf("Reason: %s\n", pc.Reason)
+	}
+	return true
+}
+
+// HandleAnnouncement shows what the server said to everyone, reporting
+// whether it was meant for gameID.
+func (gs *GameState) HandleAnnouncement(a routing.Announcement, gameID string) bool {
+	if a.GameID != "" && a.GameID != gameID {
+		return false
+	}
+
+	fmt.Println()
+	fmt.Println("************************")
+	fmt.Printf("** SERVER: %s\n", a.Message)
+	fmt.Println("************************")
+	return true
+}
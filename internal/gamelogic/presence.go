@@ -0,0 +1,92 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// HandlePresence keeps the roster of who is online, and tells whether it
+// printed anything: nothing when it's about ourselves.
+func (gs *GameState) HandlePresence(ev routing.PresenceEvent) bool {
+	gs.setOnline(ev.Online)
+	if ev.Username == gs.GetUsername() {
+		return false
+	}
+
+	message := fmt.Sprintf("%s is online", ev.Username)
+	switch ev.Kind {
+	case routing.PresenceLeave:
+		message = fmt.Sprintf("%s left", ev.Username)
+	case routing.PresenceTimeout:
+		message = fmt.Sprintf("%s lost their connection", ev.Username)
+	}
+	fmt.Println()
+	fmt.Printf("[%s] *** %s ***\n", ev.CurrentTime.Format(time.Kitchen), message)
+	return true
+}
+
+func (gs *GameState) setOnline(usernames []string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.online = map[string]bool{}
+	for _, username := range usernames {
+		gs.online[username] = true
+	}
+}
+
+func (gs *GameState) setPlayers(usernames []string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.players = append([]string{}, usernames...)
+}
+
+func (gs *GameState) IsOnline(username string) bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.online[username]
+}
+
+// GetOpponents are the other players in the game, those online and those
+// we've come across, each with whether they are online.
+func (gs *GameState) GetOpponents() map[string]bool {
+	gs.mu.RLock()
+	opponents := map[string]bool{}
+	for _, username := range gs.players {
+		opponents[username] = gs.online[username]
+	}
+	for username := range gs.online {
+		opponents[username] = true
+	}
+	gs.mu.RUnlock()
+
+	for _, username := range gs.CompleteKnownPlayers() {
+		opponents[username] = gs.IsOnline(username)
+	}
+	delete(opponents, gs.GetUsername())
+	return opponents
+}
+
+func printOpponents(opponents map[string]bool) {
+	if len(opponents) == 0 {
+		fmt.Println("You have no opponents yet.")
+		return
+	}
+
+	usernames := []string{}
+	for username := range opponents {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	fmt.Println("Opponents:")
+	for _, username := range usernames {
+		status := "offline"
+		if opponents[username] {
+			status = "online"
+		}
+		fmt.Printf("* %s (%s)\n", username, status)
+	}
+}
@@ -6,6 +6,9 @@ import (
 )
 
 func (gs *GameState) CommandSpawn(words []string) error {
+	if !gs.isPlayable() {
+		return errors.New("the game is not running, you can not spawn units")
+	}
 	if len(words) < 3 {
 		return errors.New("usage: spawn <location> <rank>")
 	}
@@ -22,7 +25,7 @@ func (gs *GameState) CommandSpawn(words []string) error {
 		return fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
+	id := gs.nextUnitID()
 	gs.addUnit(Unit{
 		ID:       id,
 		Rank:     UnitRank(rank),
@@ -0,0 +1,36 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func PrintLeaderboard(board []routing.PlayerStats) {
+	if len(board) == 0 {
+		fmt.Println("Nobody has played yet.")
+		return
+	}
+
+	fmt.Println("Leaderboard:")
+	for i, stats := range board {
+		fmt.Printf(
+			"%v. %s: %v/%v games won, %v-%v-%v wars (W-L-D)\n",
+			i+1,
+			stats.Username,
+			stats.GamesWon,
+			stats.GamesPlayed,
+			stats.Wins,
+			stats.Losses,
+			stats.Draws,
+		)
+	}
+}
+
+func PrintPlayerStats(stats routing.PlayerStats) {
+	fmt.Printf("Stats for %s:\n", stats.Username)
+	fmt.Printf("* games: %v played, %v won\n", stats.GamesPlayed, stats.GamesWon)
+	fmt.Printf("* wars: %v won, %v lost, %v drawn\n", stats.Wins, stats.Losses, stats.Draws)
+	fmt.Printf("* units: %v spawned, %v lost\n", stats.UnitsSpawned, stats.UnitsLost)
+	fmt.Printf("* territories held at the end of games: %v\n", stats.Territories)
+}
@@ -2,6 +2,8 @@ package gamelogic
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sort"
 )
 
 type WarOutcome int
@@ -14,43 +16,71 @@ const (
 	WarOutcomeDraw
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
+// RecognizeWar is the war the defender declares when am moved into its
+// units.
+func (gs *GameState) RecognizeWar(am ArmyMove) RecognitionOfWar {
+	return RecognitionOfWar{
+		Attacker: am.Player,
+		Defender: gs.GetPlayerSnapAt(am.ToLocation),
+		Seed:     warSeed(am.Player, am.ToLocation),
+	}
+}
 
-	player := gs.GetPlayerSnap()
+// warSeed comes from the attacker's units in the location, the ones their
+// move showed. The defender can't pick it, and the attacker can check it
+// against their own units.
+func warSeed(attacker Player, location Location) int64 {
+	units := []Unit{}
+	for _, unit := range attacker.Units {
+		if unit.Location == location {
+			units = append(units, unit)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
 
-	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s", attacker.Username, location)
+	for _, unit := range units {
+		fmt.Fprintf(h, "|%v:%s", unit.ID, unit.Rank)
 	}
+	return int64(h.Sum64() >> 1)
+}
 
-	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
+// HandleWar fights the war from this player's side. Attacker and defender
+// both resolve it and lose their own casualties, everyone else ignores it.
+// Each side fights with its own units as it knows them, not as the
+// recognition says, since the defender wrote it.
+func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+	player := gs.GetPlayerSnap()
+	if player.Username != rw.Attacker.Username && player.Username != rw.Defender.Username {
 		return WarOutcomeNotInvolved, "", ""
 	}
 
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== War Declared ====")
+	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
+
 	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
 	if overlappingLocation == "" {
 		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
 		return WarOutcomeNoUnits, "", ""
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
-	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+	attacker, defender := rw.Attacker, rw.Defender
+	if player.Username == rw.Attacker.Username {
+		attacker = gs.GetPlayerSnapAt(overlappingLocation)
+		if warSeed(attacker, overlappingLocation) != rw.Seed {
+			fmt.Printf("Error! %s's war doesn't match your units in %s. No war will be fought.\n", rw.Defender.Username, overlappingLocation)
+			return WarOutcomeNoUnits, "", ""
 		}
+	} else {
+		defender = gs.GetPlayerSnapAt(overlappingLocation)
 	}
 
+	attackerUnits := unitsAt(attacker, overlappingLocation)
+	defenderUnits := unitsAt(defender, overlappingLocation)
+
 	fmt.Printf("%s's units:\n", rw.Attacker.Username)
 	for _, unit := range attackerUnits {
 		fmt.Printf("  * %v\n", unit.Rank)
@@ -59,47 +89,90 @@ func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner
 	for _, unit := range defenderUnits {
 		fmt.Printf("  * %v\n", unit.Rank)
 	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
+	result := gs.getCombatResolver().Resolve(rw.Seed, attackerUnits, defenderUnits)
+	fmt.Printf("Attacker has a power level of %v\n", result.AttackerPower)
+	fmt.Printf("Defender has a power level of %v\n", result.DefenderPower)
+
+	printCasualties(rw.Attacker.Username, result.AttackerCasualties)
+	printCasualties(rw.Defender.Username, result.DefenderCasualties)
+	if player.Username == rw.Attacker.Username {
+		gs.removeUnits(result.AttackerCasualties)
+		gs.recordSighting(rw.Defender.Username, overlappingLocation, survivingUnits(defenderUnits, result.DefenderCasualties))
+	} else {
+		gs.removeUnits(result.DefenderCasualties)
+		gs.recordSighting(rw.Attacker.Username, overlappingLocation, survivingUnits(attackerUnits, result.AttackerCasualties))
+	}
+
+	if result.AttackerPower > result.DefenderPower {
 		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
 		if player.Username == rw.Defender.Username {
 			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
 			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
 		}
 		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
+	} else if result.DefenderPower > result.AttackerPower {
 		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
 		if player.Username == rw.Attacker.Username {
 			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
 			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
 		}
 		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
 	}
 	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
 	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
 }
 
+// Location is where the war is fought, the first place both sides have
+// units in.
+func (rw RecognitionOfWar) Location() Location {
+	return getOverlappingLocation(rw.Attacker, rw.Defender)
+}
+
+// SeedMatches says whether the seed is the one the attacker's units in the
+// recognition give, so the defender didn't make them up.
+func (rw RecognitionOfWar) SeedMatches() bool {
+	return warSeed(rw.Attacker, rw.Location()) == rw.Seed
+}
+
+// Resolve fights the war the way onlookers see it, from the units the
+// recognition shows of both sides, and returns what each side has left in
+// the war's location.
+func (rw RecognitionOfWar) Resolve(resolver CombatResolver) (attackerLeft, defenderLeft []Unit) {
+	location := rw.Location()
+	attackerUnits := unitsAt(rw.Attacker, location)
+	defenderUnits := unitsAt(rw.Defender, location)
+	result := resolver.Resolve(rw.Seed, attackerUnits, defenderUnits)
+	return survivingUnits(attackerUnits, result.AttackerCasualties), survivingUnits(defenderUnits, result.DefenderCasualties)
+}
+
+// unitsAt sorts the units, so a war resolves the same whatever order the
+// map gave them in.
+func unitsAt(player Player, location Location) []Unit {
+	units := []Unit{}
+	for _, unit := range player.Units {
+		if unit.Location == location {
+			units = append(units, unit)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	return units
+}
+
+func printCasualties(username string, casualties []Unit) {
+	if len(casualties) == 0 {
+		fmt.Printf("%s lost no units.\n", username)
+		return
+	}
+	fmt.Printf("%s lost %v unit(s):\n", username, len(casualties))
+	for _, unit := range casualties {
+		fmt.Printf("  * %v: %v\n", unit.ID, unit.Rank)
+	}
+}
+
 func unitsToPowerLevel(units []Unit) int {
 	power := 0
 	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
-		}
-		if unit.Rank == RankInfantry {
-			power += 1
-		}
+		power += rankPowers[unit.Rank]
 	}
 	return power
 }
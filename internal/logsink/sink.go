@@ -0,0 +1,109 @@
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	maxFileSize    = 10 << 20
+	maxFileBackups = 5
+)
+
+// LogSink is somewhere the server keeps game logs. Logs are durable once
+// Write or WriteBatch returns without an error.
+type LogSink interface {
+	Write(gamelog routing.GameLog) error
+	WriteBatch(gamelogs []routing.GameLog) error
+	Close() error
+}
+
+// FanOut writes every log to all of its sinks. A failing sink doesn't stop
+// the others, so when the delivery is requeued the sinks that did succeed
+// get the log twice.
+type FanOut []LogSink
+
+func (fo FanOut) Write(gamelog routing.GameLog) error {
+	errs := []error{}
+	for _, sink := range fo {
+		errs = append(errs, sink.Write(gamelog))
+	}
+	return errors.Join(errs...)
+}
+
+func (fo FanOut) WriteBatch(gamelogs []routing.GameLog) error {
+	errs := []error{}
+	for _, sink := range fo {
+		errs = append(errs, sink.WriteBatch(gamelogs))
+	}
+	return errors.Join(errs...)
+}
+
+func (fo FanOut) Close() error {
+	errs := []error{}
+	for _, sink := range fo {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Open builds the sinks of a comma separated spec like
+// "file:game.jsonl,sqlite:game.db,stdout".
+func Open(spec string) (LogSink, error) {
+	sinks := FanOut{}
+	for _, part := range strings.Split(spec, ",") {
+		kind, path, _ := strings.Cut(strings.TrimSpace(part), ":")
+
+		var sink LogSink
+		var err error
+		switch kind {
+		case "file":
+			if path == "" {
+				path = gamelogic.GetLogsFile()
+			}
+			sink = gamelogic.NewLogWriter(path, maxFileSize, maxFileBackups)
+		case "sqlite":
+			if path == "" {
+				err = errors.New("the sqlite sink needs a database path, sqlite:<path>")
+				break
+			}
+			sink, err = NewSQLiteSink(path)
+		case "stdout":
+			sink = NewStdoutSink(os.Stdout)
+		default:
+			err = fmt.Errorf("unknown log sink: %s", part)
+		}
+
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// FilePath is the file the spec's first file sink writes to, the one the
+// server's logs and export commands read.
+func FilePath(spec string) (string, bool) {
+	for _, part := range strings.Split(spec, ",") {
+		kind, path, _ := strings.Cut(strings.TrimSpace(part), ":")
+		if kind != "file" {
+			continue
+		}
+		if path == "" {
+			path = gamelogic.GetLogsFile()
+		}
+		return path, true
+	}
+	return "", false
+}
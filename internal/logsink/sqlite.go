@@ -0,0 +1,112 @@
+package logsink
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// participants are kept as a JSON array so queries can use sqlite's json
+// functions, e.g. json_each(participants)
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS game_logs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	time         TEXT NOT NULL,
+	game_id      TEXT NOT NULL,
+	event        TEXT NOT NULL,
+	username     TEXT NOT NULL,
+	location     TEXT NOT NULL,
+	participants TEXT NOT NULL,
+	outcome      TEXT NOT NULL,
+	message      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS game_logs_time ON game_logs (time);
+CREATE INDEX IF NOT EXISTS game_logs_game_event ON game_logs (game_id, event);
+CREATE INDEX IF NOT EXISTS game_logs_username ON game_logs (username);
+`
+
+const sqliteInsert = `
+INSERT INTO game_logs (time, game_id, event, username, location, participants, outcome, message)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type SQLiteSink struct {
+	db     *sql.DB
+	insert *sql.Stmt
+}
+
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log database: %v", err)
+	}
+
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create log tables: %v", err)
+	}
+
+	insert, err := db.Prepare(sqliteInsert)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteSink{db: db, insert: insert}, nil
+}
+
+func (ss *SQLiteSink) Write(gamelog routing.GameLog) error {
+	return ss.WriteBatch([]routing.GameLog{gamelog})
+}
+
+// WriteBatch inserts the logs in a single transaction, so the batch costs
+// one sync to disk and is either all there or not at all.
+func (ss *SQLiteSink) WriteBatch(gamelogs []routing.GameLog) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert := tx.Stmt(ss.insert)
+
+	for _, gamelog := range gamelogs {
+		participants := gamelog.Participants
+		if participants == nil {
+			participants = []string{}
+		}
+		encoded, err := json.Marshal(participants)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = insert.Exec(
+			gamelog.CurrentTime.UTC().Format(time.RFC3339Nano),
+			gamelog.GameID,
+			string(gamelog.GetEvent()),
+			gamelog.Username,
+			gamelog.Location,
+			string(encoded),
+			gamelog.Outcome,
+			gamelog.Message,
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not insert log: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not commit logs: %v", err)
+	}
+	return nil
+}
+
+func (ss *SQLiteSink) Close() error {
+	ss.insert.Close()
+	return ss.db.Close()
+}
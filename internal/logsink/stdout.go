@@ -0,0 +1,41 @@
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// StdoutSink prints logs as they come in, handy to watch a game from the
+// server's terminal.
+type StdoutSink struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func NewStdoutSink(w io.Writer) *StdoutSink {
+	return &StdoutSink{w: w, mu: &sync.Mutex{}}
+}
+
+func (ss *StdoutSink) Write(gamelog routing.GameLog) error {
+	return ss.WriteBatch([]routing.GameLog{gamelog})
+}
+
+func (ss *StdoutSink) WriteBatch(gamelogs []routing.GameLog) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, gamelog := range gamelogs {
+		_, err := fmt.Fprintln(ss.w, gamelogic.FormatLog(gamelog))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ss *StdoutSink) Close() error {
+	return nil
+}
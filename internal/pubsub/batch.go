@@ -0,0 +1,126 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SubscribeGOBBatch hands the handler up to batchSize messages at a time,
+// or fewer when maxWait passes after the first one arrived. The batch is
+// acked or nacked with a single multiple=true call, so a handler that only
+// returns Ack once the batch is durable never loses acked messages.
+func SubscribeGOBBatch[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType queueType,
+	batchSize int,
+	maxWait time.Duration,
+	handler func([]T) AckType,
+	opts ...SubscribeOption[T],
+) error {
+	return subscribeBatch(conn, exchange, queueName, key, simpleQueueType, batchSize, maxWait, handler, unmarshalGOB, opts)
+}
+
+func subscribeBatch[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType queueType,
+	batchSize int,
+	maxWait time.Duration,
+	handler func([]T) AckType,
+	unmarshaller func([]byte) (T, error),
+	opts []SubscribeOption[T],
+) error {
+	options := subscribeOptions[T]{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	channel, queue, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
+	if err != nil {
+		return err
+	}
+
+	// twice the batch size so the next batch arrives while the last one
+	// is being committed
+	err = channel.Qos(2*batchSize, 0, false)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	messages, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	go func() {
+		// the deliveries end when the queue is deleted, the channel was
+		// only for this subscription
+		defer channel.Close()
+		bodies := []T{}
+		var last amqp.Delivery
+		var deadline <-chan time.Time
+
+		flush := func() {
+			if len(bodies) == 0 {
+				return
+			}
+
+			switch handler(bodies) {
+			case Ack:
+				last.Ack(true)
+			case NackRequeue:
+				last.Nack(true, true)
+			default:
+				last.Nack(true, false)
+			}
+			bodies = []T{}
+			deadline = nil
+		}
+
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					flush()
+					return
+				}
+
+				body, err := unmarshaller(message.Body)
+				if err != nil {
+					fmt.Printf("cannot unmarshall delivery message body: %v\n", err)
+					message.Nack(false, false)
+					continue
+				}
+				err = options.check(message, body)
+				recordConsume(message, err)
+				if err != nil {
+					fmt.Printf("rejected delivery on %s: %v\n", message.RoutingKey, err)
+					message.Nack(false, false)
+					continue
+				}
+
+				bodies = append(bodies, body)
+				last = message
+				if deadline == nil {
+					deadline = time.After(maxWait)
+				}
+				if len(bodies) >= batchSize {
+					flush()
+				}
+			case <-deadline:
+				flush()
+			}
+		}
+	}()
+
+	return nil
+}
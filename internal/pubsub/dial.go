@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DialOptions are how to reach a broker over amqps://. CA, Cert and Key
+// are PEM files, an empty CA trusts the system's roots. With External the
+// broker takes the user from the client certificate (SASL EXTERNAL)
+// instead of a password in the url.
+type DialOptions struct {
+	CA         string
+	Cert       string
+	Key        string
+	ServerName string
+	External   bool
+}
+
+func Dial(rawURL string, opts DialOptions) (*amqp.Connection, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker url: %v", err)
+	}
+	if u.Scheme != "amqps" {
+		if opts != (DialOptions{}) {
+			return nil, errors.New("tls options need an amqps:// url")
+		}
+		return amqp.Dial(rawURL)
+	}
+
+	tlsConfig, err := TLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	config := amqp.Config{TLSClientConfig: tlsConfig}
+	if opts.External {
+		if len(tlsConfig.Certificates) == 0 {
+			return nil, errors.New("sasl external needs a client certificate")
+		}
+		config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	}
+	return amqp.DialConfig(rawURL, config)
+}
+
+func TLSConfig(opts DialOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+
+	if opts.CA != "" {
+		pem, err := os.ReadFile(opts.CA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read broker ca: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in the broker ca file")
+		}
+	}
+
+	if opts.Cert != "" || opts.Key != "" {
+		cert, err := tls.LoadX509KeyPair(opts.Cert, opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -5,28 +5,23 @@ import (
 	"context"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	bytes, err := json.Marshal(val)
 	if err != nil {
 		return err
 	}
 
-	return ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false,
-		false,
-		amqp.Publishing{ContentType: "application/json", Body: bytes},
-	)
+	return publish(ch, exchange, key, amqp.Publishing{ContentType: "application/json", Body: bytes}, opts)
 }
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	var buffer bytes.Buffer
 	encoder := gob.NewEncoder(&buffer)
 
@@ -35,14 +30,44 @@ func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
 		return err
 	}
 
-	return ch.PublishWithContext(
+	return publish(ch, exchange, key, amqp.Publishing{ContentType: "application/gob", Body: buffer.Bytes()}, opts)
+}
+
+func publish(ch *amqp.Channel, exchange, key string, publishing amqp.Publishing, opts []PublishOption) error {
+	for _, opt := range opts {
+		opt(&publishing)
+	}
+
+	err := ch.PublishWithContext(
 		context.Background(),
 		exchange,
 		key,
 		false,
 		false,
-		amqp.Publishing{ContentType: "application/gob", Body: buffer.Bytes()},
+		publishing,
 	)
+	if err != nil {
+		return err
+	}
+
+	recordPublish(exchange, key, publishing)
+	return nil
+}
+
+// QueueOptions are shared by every queue the game declares. Prefetch
+// limits how many unacked deliveries a subscriber holds, 0 is no limit,
+// and a MessageTTL of 0 keeps messages until they're consumed.
+type QueueOptions struct {
+	DeadLetterExchange string
+	Prefetch           int
+	MessageTTL         time.Duration
+}
+
+var queueOptions = QueueOptions{DeadLetterExchange: "peril_dlx"}
+
+// SetQueueOptions must be called before anything is subscribed.
+func SetQueueOptions(opts QueueOptions) {
+	queueOptions = opts
 }
 
 type queueType int
@@ -66,30 +91,58 @@ func DeclareAndBind(
 
 	var queue amqp.Queue
 	queueTable := amqp.Table{}
-	queueTable["x-dead-letter-exchange"] = "peril_dlx"
+	if queueOptions.DeadLetterExchange != "" {
+		queueTable["x-dead-letter-exchange"] = queueOptions.DeadLetterExchange
+	}
+	if queueOptions.MessageTTL > 0 {
+		queueTable["x-message-ttl"] = queueOptions.MessageTTL.Milliseconds()
+	}
 
 	if simpleQueueType == transient {
 		queue, err = channel.QueueDeclare(queueName, true, true, false, false, queueTable)
 		if err != nil {
-			return nil, amqp.Queue{}, err
+			channel.Close()
+			return nil, amqp.Queue{}, declareError(queueName, err)
 		}
 	}
 
 	if simpleQueueType == nonTransient {
-		queue, err = channel.QueueDeclare(queueName, true, false, false, false, nil)
+		args := amqp.Table{}
+		if queueOptions.MessageTTL > 0 {
+			args["x-message-ttl"] = queueOptions.MessageTTL.Milliseconds()
+		}
+		queue, err = channel.QueueDeclare(queueName, true, false, false, false, args)
 		if err != nil {
-			return nil, amqp.Queue{}, err
+			channel.Close()
+			return nil, amqp.Queue{}, declareError(queueName, err)
 		}
 	}
 
 	err = channel.QueueBind(queue.Name, key, exchange, false, nil)
 	if err != nil {
+		channel.Close()
 		return nil, amqp.Queue{}, err
 	}
 
 	return channel, queue, nil
 }
 
+// declareError explains the broker refusing a queue that already exists
+// with other arguments. The queues are durable, so they keep the message
+// ttl they were first declared with until they're deleted.
+func declareError(queueName string, err error) error {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		return err
+	}
+	return fmt.Errorf(
+		"queue %s exists with other arguments, was queues.message_ttl changed? Delete the queue, e.g. rabbitmqctl delete_queue %s, or leave message_ttl at 0 and set the ttl with a broker policy instead: %w",
+		queueName,
+		queueName,
+		err,
+	)
+}
+
 type AckType int
 
 const (
@@ -105,8 +158,9 @@ func SubscribeJSON[T any](
 	key string,
 	simpleQueueType queueType,
 	handler func(T) AckType,
+	opts ...SubscribeOption[T],
 ) error {
-	return subscribe(conn, exchange, queueName, key, simpleQueueType, handler, unmarshalJSON)
+	return subscribe(conn, exchange, queueName, key, simpleQueueType, handler, unmarshalJSON, opts)
 }
 
 func SubscribeGOB[T any](
@@ -116,8 +170,9 @@ func SubscribeGOB[T any](
 	key string,
 	simpleQueueType queueType,
 	handler func(T) AckType,
+	opts ...SubscribeOption[T],
 ) error {
-	return subscribe(conn, exchange, queueName, key, simpleQueueType, handler, unmarshalGOB)
+	return subscribe(conn, exchange, queueName, key, simpleQueueType, handler, unmarshalGOB, opts)
 }
 
 func unmarshalGOB[T any](toUnmarshal []byte) (T, error) {
@@ -152,24 +207,50 @@ func subscribe[T any](
 	simpleQueueType queueType,
 	handler func(T) AckType,
 	unmarshaller func([]byte) (T, error),
+	opts []SubscribeOption[T],
 ) error {
+	options := subscribeOptions[T]{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	channel, queue, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
 	if err != nil {
 		return err
 	}
 
+	if queueOptions.Prefetch > 0 {
+		err = channel.Qos(queueOptions.Prefetch, 0, false)
+		if err != nil {
+			channel.Close()
+			return err
+		}
+	}
+
 	messages, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
 	if err != nil {
+		channel.Close()
 		return err
 	}
 
 	go func() {
+		// the deliveries end when the queue is deleted, the channel was
+		// only for this subscription
+		defer channel.Close()
 		for message := range messages {
 			body, err := unmarshaller(message.Body)
 			if err != nil {
 				fmt.Printf("cannot unmarshall delivery message body: %v", err)
 			}
 
+			err = options.check(message, body)
+			recordConsume(message, err)
+			if err != nil {
+				fmt.Printf("rejected delivery on %s: %v\n", message.RoutingKey, err)
+				message.Nack(false, false)
+				continue
+			}
+
 			ackType := handler(body)
 
 			if ackType == Ack {
@@ -0,0 +1,22 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeclareErrorExplainsChangedArguments(t *testing.T) {
+	refused := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'x-message-ttl'"}
+	err := declareError("main.game_logs", refused)
+	if !errors.Is(err, refused) || !strings.Contains(err.Error(), "delete_queue main.game_logs") {
+		t.Fatalf("got %v", err)
+	}
+
+	other := &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange"}
+	if err := declareError("main.game_logs", other); err != other {
+		t.Fatalf("got %v, want the broker's error as is", err)
+	}
+}
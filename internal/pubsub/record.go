@@ -0,0 +1,167 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Direction says whether a record is a message the process published, one
+// it consumed, or a note about what happened in between, like a command
+// typed. Every recording starts with a single start record.
+type Direction string
+
+const (
+	DirectionStart   Direction = "start"
+	DirectionPublish Direction = "publish"
+	DirectionConsume Direction = "consume"
+	DirectionNote    Direction = "note"
+)
+
+// Record is one line of a recording. Seq orders the records of a process:
+// published messages are recorded once the broker took them, consumed ones
+// right before their handler runs.
+type Record struct {
+	Seq         int64
+	Time        time.Time
+	Direction   Direction
+	Exchange    string            `json:",omitempty"`
+	RoutingKey  string            `json:",omitempty"`
+	ContentType string            `json:",omitempty"`
+	Headers     map[string]string `json:",omitempty"`
+	DeliveryTag uint64            `json:",omitempty"`
+	Redelivered bool              `json:",omitempty"`
+	Rejected    string            `json:",omitempty"`
+	Body        []byte            `json:",omitempty"`
+	Note        string            `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+}
+
+// Recorder writes every message published and consumed through this
+// package to a JSONL file. RPCs are left out, they carry passwords.
+type Recorder struct {
+	out *json.Encoder
+	seq int64
+	mu  *sync.Mutex
+}
+
+// NewRecorder starts a recording with meta, whatever a replay needs to
+// know about the process.
+func NewRecorder(w io.Writer, meta map[string]string) (*Recorder, error) {
+	r := &Recorder{
+		out: json.NewEncoder(w),
+		mu:  &sync.Mutex{},
+	}
+	err := r.out.Encode(Record{Time: time.Now(), Direction: DirectionStart, Meta: meta})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) record(rec Record) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	rec.Seq = r.seq
+	rec.Time = time.Now()
+	err := r.out.Encode(rec)
+	if err != nil {
+		fmt.Printf("couldn't record message: %v\n", err)
+	}
+}
+
+var recorder atomic.Pointer[Recorder]
+
+// SetRecorder records everything published and consumed from then on.
+func SetRecorder(r *Recorder) {
+	recorder.Store(r)
+}
+
+// RecordNote adds a note to the recording, if there is one.
+func RecordNote(note string) {
+	recorder.Load().record(Record{Direction: DirectionNote, Note: note})
+}
+
+func recordPublish(exchange, key string, publishing amqp.Publishing) {
+	recorder.Load().record(Record{
+		Direction:   DirectionPublish,
+		Exchange:    exchange,
+		RoutingKey:  key,
+		ContentType: publishing.ContentType,
+		Headers:     recordedHeaders(publishing.Headers),
+		Body:        publishing.Body,
+	})
+}
+
+// recordConsume records a delivery, and why it was rejected before its
+// handler could see it.
+func recordConsume(delivery amqp.Delivery, rejected error) {
+	rec := Record{
+		Direction:   DirectionConsume,
+		Exchange:    delivery.Exchange,
+		RoutingKey:  delivery.RoutingKey,
+		ContentType: delivery.ContentType,
+		Headers:     recordedHeaders(delivery.Headers),
+		DeliveryTag: delivery.DeliveryTag,
+		Redelivered: delivery.Redelivered,
+		Body:        delivery.Body,
+	}
+	if rejected != nil {
+		rec.Rejected = rejected.Error()
+	}
+	recorder.Load().record(rec)
+}
+
+func recordedHeaders(headers amqp.Table) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	recorded := map[string]string{}
+	for name, value := range headers {
+		switch v := value.(type) {
+		case []byte:
+			recorded[name] = hex.EncodeToString(v)
+		default:
+			recorded[name] = fmt.Sprint(v)
+		}
+	}
+	return recorded
+}
+
+// ReadRecording returns the start record's meta and every record after it.
+func ReadRecording(r io.Reader) (map[string]string, []Record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	records := []Record{}
+	for scanner.Scan() {
+		var rec Record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("record %v: %v", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(records) == 0 || records[0].Direction != DirectionStart {
+		return nil, nil, errors.New("not a recording: it doesn't begin with a start record")
+	}
+	return records[0].Meta, records[1:], nil
+}
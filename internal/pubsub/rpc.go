@@ -0,0 +1,175 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const rpcErrorHeader = "x-rpc-error"
+
+var ErrRPCTimeout = errors.New("rpc call timed out")
+
+// CallJSON publishes req and waits for the reply on a private, exclusive
+// queue that the broker names and deletes for us.
+func CallJSON[Req, Resp any](
+	conn *amqp.Connection,
+	exchange,
+	key string,
+	req Req,
+	timeout time.Duration,
+) (Resp, error) {
+	var resp Resp
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return resp, err
+	}
+	defer channel.Close()
+
+	replyQueue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return resp, err
+	}
+
+	replies, err := channel.Consume(replyQueue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	correlationID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	err = channel.PublishWithContext(
+		context.Background(),
+		exchange,
+		key,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			Body:          body,
+			ReplyTo:       replyQueue.Name,
+			CorrelationId: correlationID,
+		},
+	)
+	if err != nil {
+		return resp, err
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case reply, ok := <-replies:
+			if !ok {
+				return resp, errors.New("reply queue was closed")
+			}
+			if reply.CorrelationId != correlationID {
+				continue
+			}
+			if rpcErr, ok := reply.Headers[rpcErrorHeader].(string); ok {
+				return resp, errors.New(rpcErr)
+			}
+			return unmarshalJSON[Resp](reply.Body)
+		case <-deadline:
+			return resp, ErrRPCTimeout
+		}
+	}
+}
+
+// ServeJSON answers CallJSON requests. An error from the handler travels
+// back to the caller in a header instead of the body.
+func ServeJSON[Req, Resp any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType queueType,
+	handler func(Req) (Resp, error),
+) error {
+	channel, queue, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
+	if err != nil {
+		return err
+	}
+
+	requests, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	go serveRequests(channel, requests, handler)
+	return nil
+}
+
+// ServePrivateJSON answers CallJSON requests sent to queueName through the
+// default exchange. The queue is exclusive to conn, so while it's up nobody
+// else can consume it, and the default exchange can't be bound to, so
+// nobody else gets a copy either. That only holds if the broker's
+// permissions stop other users from declaring queueName before us or
+// reading from it, see the README.
+func ServePrivateJSON[Req, Resp any](
+	conn *amqp.Connection,
+	queueName string,
+	handler func(Req) (Resp, error),
+) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	queue, err := channel.QueueDeclare(queueName, false, true, true, false, nil)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("couldn't declare %s, is another server or someone else holding it? %v", queueName, err)
+	}
+
+	requests, err := channel.Consume(queue.Name, "", false, true, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	go serveRequests(channel, requests, handler)
+	return nil
+}
+
+func serveRequests[Req, Resp any](channel *amqp.Channel, requests <-chan amqp.Delivery, handler func(Req) (Resp, error)) {
+	for request := range requests {
+		publishing := amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: request.CorrelationId,
+		}
+
+		req, err := unmarshalJSON[Req](request.Body)
+		if err != nil {
+			publishing.Headers = amqp.Table{rpcErrorHeader: fmt.Sprintf("invalid request: %v", err)}
+		} else {
+			resp, err := handler(req)
+			if err != nil {
+				publishing.Headers = amqp.Table{rpcErrorHeader: err.Error()}
+			} else {
+				publishing.Body, err = json.Marshal(resp)
+				if err != nil {
+					publishing.Headers = amqp.Table{rpcErrorHeader: err.Error()}
+				}
+			}
+		}
+
+		if request.ReplyTo != "" {
+			err = channel.PublishWithContext(context.Background(), "", request.ReplyTo, false, false, publishing)
+			if err != nil {
+				fmt.Printf("cannot reply to rpc request: %v", err)
+			}
+		}
+
+		request.Ack(false)
+	}
+}
@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Session is what a player gets for logging in. Its token is a bearer
+// secret: it only goes to the server, in the body of rpcs that need it.
+// Messages everyone can read are signed instead, see WithSignature. The
+// inbox is a secret too, it names the player's private routing keys.
+type Session struct {
+	Username string
+	Token    string
+	Inbox    string
+}
+
+type PublishOption func(*amqp.Publishing)
+
+type subscribeOptions[T any] struct {
+	checks []func(amqp.Delivery, T) error
+}
+
+type SubscribeOption[T any] func(*subscribeOptions[T])
+
+func (opts subscribeOptions[T]) check(delivery amqp.Delivery, body T) error {
+	for _, check := range opts.checks {
+		err := check(delivery, body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	signerHeader    = "x-peril-signer"
+	signatureHeader = "x-peril-signature"
+)
+
+var (
+	ErrNoSignature  = errors.New("message is not signed")
+	ErrBadSignature = errors.New("message signature does not match its signer")
+)
+
+// Signer is a player's private key. Its public half is handed to the
+// server's key registry when the player logs in.
+type Signer struct {
+	Username string
+	Key      ed25519.PrivateKey
+}
+
+type KeyRegistry interface {
+	PublicKey(username string) (ed25519.PublicKey, error)
+}
+
+// WithSignature signs the encoded body, so it has to come after anything
+// else that changes it.
+func WithSignature(signer Signer) PublishOption {
+	return func(publishing *amqp.Publishing) {
+		if signer.Key == nil {
+			return
+		}
+		if publishing.Headers == nil {
+			publishing.Headers = amqp.Table{}
+		}
+		publishing.Headers[signerHeader] = signer.Username
+		publishing.Headers[signatureHeader] = ed25519.Sign(signer.Key, publishing.Body)
+	}
+}
+
+// RequireSignature discards messages that aren't signed by the registered
+// key of their signer. When claimant is set the signer also has to be the
+// player the message body claims to come from.
+func RequireSignature[T any](registry KeyRegistry, claimant func(T) string) SubscribeOption[T] {
+	return func(opts *subscribeOptions[T]) {
+		opts.checks = append(opts.checks, func(delivery amqp.Delivery, body T) error {
+			signer, _ := delivery.Headers[signerHeader].(string)
+			signature, _ := delivery.Headers[signatureHeader].([]byte)
+			if signer == "" || len(signature) == 0 {
+				return ErrNoSignature
+			}
+
+			if claimant != nil && claimant(body) != signer {
+				return fmt.Errorf("%s signed a message claiming to be %s", signer, claimant(body))
+			}
+
+			key, err := registry.PublicKey(signer)
+			if err != nil {
+				return err
+			}
+			if !ed25519.Verify(key, delivery.Body, signature) {
+				return ErrBadSignature
+			}
+			return nil
+		})
+	}
+}
@@ -6,8 +6,227 @@ type PlayingState struct {
 	IsPaused bool
 }
 
+type PlayerAction string
+
+const (
+	PlayerPause  PlayerAction = "pause"
+	PlayerResume PlayerAction = "resume"
+	PlayerKick   PlayerAction = "kick"
+)
+
+// PlayerControl is the server acting on a single player, where a
+// PlayingState pauses everyone.
+type PlayerControl struct {
+	CurrentTime time.Time
+	Action      PlayerAction
+	Username    string
+	Reason      string
+}
+
+// Announcement is free text from the server to a single room, or to every
+// room when it has no GameID.
+type Announcement struct {
+	CurrentTime time.Time
+	GameID      string
+	Message     string
+}
+
+type LogEvent string
+
+const (
+	LogEventMessage   LogEvent = "message"
+	LogEventWar       LogEvent = "war"
+	LogEventDiplomacy LogEvent = "diplomacy"
+	LogEventLifecycle LogEvent = "lifecycle"
+)
+
+// GameLog is one line of the game's history. Only CurrentTime, Message and
+// Username are always set, logs from older clients carry nothing else. A
+// war log is one side's report, Username is who reported it and Seed tells
+// which war it was.
 type GameLog struct {
+	CurrentTime  time.Time
+	Message      string
+	Username     string
+	Event        LogEvent `json:",omitempty"`
+	GameID       string   `json:",omitempty"`
+	Location     string   `json:",omitempty"`
+	Participants []string `json:",omitempty"`
+	Outcome      string   `json:",omitempty"`
+	Winner       string   `json:",omitempty"`
+	Seed         int64    `json:",omitempty"`
+}
+
+// GetEvent treats logs without an event as plain messages.
+func (gl GameLog) GetEvent() LogEvent {
+	if gl.Event == "" {
+		return LogEventMessage
+	}
+	return gl.Event
+}
+
+type ChatChannel string
+
+const (
+	ChatGlobal   ChatChannel = "global"
+	ChatAlliance ChatChannel = "alliance"
+	ChatDirect   ChatChannel = "dm"
+	ChatSystem   ChatChannel = "system"
+	ChatKick     ChatChannel = "kick"
+)
+
+type ChatMessage struct {
 	CurrentTime time.Time
+	Channel     ChatChannel
+	From        string
+	To          string
 	Message     string
+	History     bool
+}
+
+type LobbyRegistration struct {
+	CurrentTime time.Time
 	Username    string
 }
+
+type GamePhase string
+
+const (
+	GamePhaseLobby   GamePhase = "lobby"
+	GamePhaseStarted GamePhase = "started"
+	GamePhaseOver    GamePhase = "over"
+)
+
+type Standing struct {
+	Username    string
+	Territories int
+	Units       int
+	Score       int
+}
+
+// GameLifecycle is the room's phase and rules. Both sides of a war resolve
+// it on their own, so Combat names the rules every player must use.
+type GameLifecycle struct {
+	CurrentTime time.Time
+	Phase       GamePhase
+	Combat      string
+	Players     []string
+	Territories int
+	TimeLimit   time.Duration
+	Winner      string
+	Reason      string
+	Standings   []Standing
+}
+
+// PlayerStats add up every game a player took part in. Territories are
+// the ones held when the games ended.
+type PlayerStats struct {
+	Username     string
+	Wins         int
+	Losses       int
+	Draws        int
+	UnitsSpawned int
+	UnitsLost    int
+	Territories  int
+	GamesPlayed  int
+	GamesWon     int
+}
+
+// Clients send a Heartbeat every HeartbeatInterval while they're in a
+// room, the server takes them for gone after HeartbeatTimeout without one.
+const (
+	HeartbeatInterval = 5 * time.Second
+	HeartbeatTimeout  = 3 * HeartbeatInterval
+)
+
+// Heartbeat says a player is still there, or with Leaving set that they
+// quit.
+type Heartbeat struct {
+	CurrentTime time.Time
+	Username    string
+	Leaving     bool
+}
+
+type PresenceKind string
+
+const (
+	PresenceJoin    PresenceKind = "join"
+	PresenceLeave   PresenceKind = "leave"
+	PresenceTimeout PresenceKind = "timeout"
+)
+
+// PresenceEvent tells everyone in a room that Username came or went, and
+// who is online now.
+type PresenceEvent struct {
+	CurrentTime time.Time
+	Kind        PresenceKind
+	Username    string
+	Online      []string
+}
+
+type RoomInfo struct {
+	GameID  string
+	Phase   GamePhase
+	Combat  string
+	Players int
+}
+
+// MatchRequest asks the server for a game of Size players, or to leave
+// the matchmaking queue when Cancel is set.
+type MatchRequest struct {
+	CurrentTime time.Time
+	Username    string
+	Size        int
+	Cancel      bool
+}
+
+type MatchState string
+
+const (
+	MatchQueued    MatchState = "queued"
+	MatchCancelled MatchState = "cancelled"
+	MatchFound     MatchState = "found"
+	MatchTimedOut  MatchState = "timed_out"
+)
+
+// MatchUpdate goes to a single player's matchmaking queue. A found match
+// names the room to join, a timed out one the room the player was removed
+// from.
+type MatchUpdate struct {
+	CurrentTime time.Time
+	State       MatchState
+	Size        int
+	GameID      string
+	Players     []string
+	Reason      string
+}
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type SessionToken struct {
+	Username  string
+	Token     string
+	Inbox     string
+	ExpiresAt time.Time
+}
+
+// PublicKeyRegistration carries the session token itself because rpc
+// requests don't go through the session headers. Replacing a registered key
+// takes Rotation, the new key signed with the old one.
+type PublicKeyRegistration struct {
+	Username  string
+	Token     string
+	PublicKey []byte
+	Rotation  []byte
+}
+
+// PublicKey is a player's signing key. Looked up, it comes with the
+// server's signature, see auth.RemoteKeyRegistry.
+type PublicKey struct {
+	Username  string
+	PublicKey []byte
+	Signature []byte `json:",omitempty"`
+}
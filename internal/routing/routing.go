@@ -1,5 +1,7 @@
 package routing
 
+import "strings"
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
@@ -7,10 +9,62 @@ const (
 
 	PauseKey = "pause"
 
+	PlayerControlPrefix = "player_control"
+
+	AnnouncementsKey = "announcements"
+
 	GameLogSlug = "game_logs"
+
+	DiplomacyPrefix = "diplomacy"
+
+	LobbyPrefix = "lobby"
+
+	PlayerStatusPrefix = "player_status"
+
+	PresencePrefix    = "presence"
+	PresenceEventsKey = "presence_events"
+
+	GameLifecycleKey = "lifecycle"
+
+	RoomsListKey = "rooms.list"
+
+	StatsKey = "stats.get"
+
+	// queues the server owns, reached through the default exchange since
+	// they carry passwords and session tokens
+	AuthRegisterKey = "auth.register"
+	AuthLoginKey    = "auth.login"
+	KeysRegisterKey = "keys.register"
+
+	KeysLookupKey     = "keys.lookup"
+	KeysChangedPrefix = "keys.changed"
+
+	MatchRequestPrefix = "matchmaking.request"
+	MatchUpdatePrefix  = "matchmaking.update"
+
+	// players send chat to, and get their private chat from, the direct
+	// exchange under their session's inbox, which only they and the server
+	// know as long as the broker doesn't let players list queues or
+	// bindings, see the README. Only global chat goes out on the topic
+	// exchange.
+	ChatSendPrefix  = "chat.send"
+	ChatInboxPrefix = "chat.inbox"
+	ChatGlobalKey   = "chat.global"
 )
 
-const (
+// ServerSigner is who the server signs its messages as. Players can't
+// register the name, it isn't a valid username.
+const ServerSigner = "#server"
+
+// The exchanges can be renamed by the config, so several games can share a
+// broker.
+var (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
 )
+
+// GameKey scopes a routing key or queue name to a single game room, e.g.
+// GameKey("g1", ArmyMovesPrefix, "*") is "g1.army_moves.*".
+func GameKey(gameID string, parts ...string) string {
+	return strings.Join(append([]string{gameID}, parts...), ".")
+}
@@ -1,33 +1,14 @@
 #!/bin/bash
 
-# Check if the number of instances was provided
+# Scales the consumers of every room's game logs. They compete for the same
+# queues, so they run in one server: the server pairs up both sides of a
+# war, which separate processes sharing the queues couldn't. For separate
+# games sharing a broker, see multiinstance.sh.
+
+# Check if the number of consumers was provided
 if [ -z "$1" ]; then
-  echo "Usage: $0 <number-of-instances>"
+  echo "Usage: $0 <number-of-log-consumers>"
   exit 1
 fi
 
-num_instances=$1
-
-# Array to store process IDs
-declare -a pids
-
-# Function to kill all processes when Ctrl+C is pressed
-cleanup() {
-  echo "Terminating all instances of ./cmd/server..."
-  for pid in "${pids[@]}"; do
-    kill -SIGTERM "$pid"
-  done
-  exit
-}
-
-# Setup trap for SIGINT
-trap 'cleanup' SIGINT
-
-# Start the specified number of instances of the program in the background
-for (( i=0; i<num_instances; i++ )); do
-  go run ./cmd/server &
-  pids+=($!)
-done
-
-# Wait for all background processes to finish
-wait
+exec go run ./cmd/server -log-consumers "$1"
@@ -5,6 +5,53 @@ case "$1" in
         echo "Starting RabbitMQ container..."
         docker run -d --rm --name rabbitmq -p 5672:5672 -p 15672:15672 rabbitmq:3.13-management
         ;;
+    certs)
+        user="${2:-peril}"
+        echo "Making a local CA with broker and client ($user) certificates in ./certs..."
+        mkdir -p certs
+        openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj "/CN=peril-ca" \
+            -keyout certs/ca.key -out certs/ca.pem
+        openssl req -newkey rsa:2048 -nodes -subj "/CN=localhost" \
+            -keyout certs/server.key -out certs/server.csr
+        openssl x509 -req -in certs/server.csr -CA certs/ca.pem -CAkey certs/ca.key -CAcreateserial -days 365 \
+            -extfile <(printf "subjectAltName=DNS:localhost,IP:127.0.0.1") -out certs/server.pem
+        openssl req -newkey rsa:2048 -nodes -subj "/CN=$user" \
+            -keyout certs/client.key -out certs/client.csr
+        openssl x509 -req -in certs/client.csr -CA certs/ca.pem -CAkey certs/ca.key -CAcreateserial -days 365 \
+            -extfile <(printf "extendedKeyUsage=clientAuth") -out certs/client.pem
+        rm certs/*.csr
+        chmod 600 certs/*.key
+        echo "The broker needs a user named $user to accept SASL EXTERNAL logins."
+        ;;
+    start-tls)
+        echo "Starting RabbitMQ container with TLS on 5671..."
+        cat > certs/rabbitmq.conf <<EOF2
+listeners.ssl.default = 5671
+ssl_options.cacertfile = /certs/ca.pem
+ssl_options.certfile = /certs/server.pem
+ssl_options.keyfile = /certs/server.key
+ssl_options.verify = verify_peer
+ssl_options.fail_if_no_peer_cert = false
+ssl_cert_login_from = common_name
+auth_mechanisms.1 = PLAIN
+auth_mechanisms.2 = AMQPLAIN
+auth_mechanisms.3 = EXTERNAL
+EOF2
+        echo "[rabbitmq_management,rabbitmq_auth_mechanism_ssl]." > certs/enabled_plugins
+        # the keys stay private on the host, the broker gets copies it owns
+        docker volume create peril-rabbitmq-certs > /dev/null
+        docker run --rm --user root \
+            -v "$PWD/certs:/src:ro" \
+            -v peril-rabbitmq-certs:/certs \
+            rabbitmq:3.13-management \
+            sh -c 'cp /src/ca.pem /src/server.pem /src/server.key /src/rabbitmq.conf /src/enabled_plugins /certs/ &&
+                chown -R rabbitmq:rabbitmq /certs && chmod 600 /certs/server.key' || exit 1
+        docker run -d --rm --name rabbitmq -p 5671:5671 -p 5672:5672 -p 15672:15672 \
+            -v peril-rabbitmq-certs:/certs \
+            -e RABBITMQ_CONFIG_FILE=/certs/rabbitmq.conf \
+            -e RABBITMQ_ENABLED_PLUGINS_FILE=/certs/enabled_plugins \
+            rabbitmq:3.13-management
+        ;;
     stop)
         echo "Stopping RabbitMQ container..."
         docker stop rabbitmq
@@ -14,6 +61,6 @@ case "$1" in
         docker logs -f rabbitmq
         ;;
     *)
-        echo "Usage: $0 {start|stop|logs}"
+        echo "Usage: $0 {start|start-tls|certs [user]|stop|logs}"
         exit 1
 esac